@@ -0,0 +1,176 @@
+package caddy_esbuild_plugin
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+func init() {
+	caddy.RegisterModule(AdminAPI{})
+}
+
+// handlers holds every provisioned esbuild handler by id, for the admin API.
+var handlers = struct {
+	lock  sync.Mutex
+	items map[string]registeredHandler
+}{items: make(map[string]registeredHandler)}
+
+// registeredHandler remembers the config a handler was loaded with, to tell a
+// handler replaced by a config reload from two handlers sharing an id.
+type registeredHandler struct {
+	handler *Esbuild
+	config  context.Context
+}
+
+// buildStatus describes the last build of a handler.
+type buildStatus struct {
+	Time     time.Time `json:"time"`
+	Duration int64     `json:"duration_ms"`
+	Warnings []string  `json:"warnings"`
+	Errors   []string  `json:"errors"`
+}
+
+type handlerStatus struct {
+	ID        string       `json:"id"`
+	Target    string       `json:"target"`
+	Sources   []string     `json:"sources"`
+	LastBuild *buildStatus `json:"last_build"`
+}
+
+// AdminAPI lists the esbuild handlers at "/esbuild/" and rebuilds one
+// with "POST /esbuild/<id>/rebuild".
+type AdminAPI struct{}
+
+// CaddyModule returns the Caddy module information.
+func (AdminAPI) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "admin.api.esbuild",
+		New: func() caddy.Module { return new(AdminAPI) },
+	}
+}
+
+// Routes implements caddy.AdminRouter.
+func (a AdminAPI) Routes() []caddy.AdminRoute {
+	return []caddy.AdminRoute{
+		{
+			Pattern: "/esbuild/",
+			Handler: caddy.AdminHandlerFunc(a.handleAPI),
+		},
+	}
+}
+
+func (a AdminAPI) handleAPI(w http.ResponseWriter, r *http.Request) error {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/esbuild/"), "/")
+	if path == "" {
+		if r.Method != http.MethodGet {
+			return caddy.APIError{HTTPStatus: http.StatusMethodNotAllowed, Err: fmt.Errorf("method not allowed")}
+		}
+
+		handlers.lock.Lock()
+		statuses := []handlerStatus{}
+		for _, registered := range handlers.items {
+			statuses = append(statuses, registered.handler.status())
+		}
+		handlers.lock.Unlock()
+
+		sort.Slice(statuses, func(i, j int) bool {
+			return statuses[i].ID < statuses[j].ID
+		})
+		return writeJSON(w, statuses)
+	}
+
+	parts := strings.SplitN(path, "/", 2)
+	handlers.lock.Lock()
+	m := handlers.items[parts[0]].handler
+	handlers.lock.Unlock()
+	if m == nil {
+		return caddy.APIError{HTTPStatus: http.StatusNotFound, Err: fmt.Errorf("unknown esbuild handler: %s", parts[0])}
+	}
+
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		return writeJSON(w, m.status())
+	case len(parts) == 2 && parts[1] == "rebuild" && r.Method == http.MethodPost:
+		m.logger.Info("Rebuild requested through the admin API")
+		m.Rebuild()
+		return writeJSON(w, m.status())
+	case len(parts) == 2 && parts[1] == "rebuild":
+		return caddy.APIError{HTTPStatus: http.StatusMethodNotAllowed, Err: fmt.Errorf("method not allowed")}
+	default:
+		return caddy.APIError{HTTPStatus: http.StatusNotFound, Err: fmt.Errorf("not found: %s", r.URL.Path)}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, value interface{}) error {
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(value)
+}
+
+// handlerID is the configured id, or one derived from the target and the sources,
+// which stays the same across config reloads.
+func (m *Esbuild) handlerID() string {
+	if m.ID != "" {
+		return m.ID
+	}
+	hasher := sha1.New()
+	hasher.Write([]byte(m.outdir()))
+	for _, s := range m.Sources {
+		hasher.Write([]byte("\n" + s.InputPath + "=" + s.OutputPath))
+	}
+	return hex.EncodeToString(hasher.Sum(nil))[:8]
+}
+
+// register fails for a duplicate id within the same config. Handlers from an
+// older config are replaced silently, a reload provisions before cleaning up.
+func (m *Esbuild) register(ctx caddy.Context) error {
+	handlers.lock.Lock()
+	defer handlers.lock.Unlock()
+
+	id := m.handlerID()
+	if existing, ok := handlers.items[id]; ok && existing.config == ctx.Context {
+		if m.ID != "" {
+			return fmt.Errorf("duplicate esbuild id: %s", id)
+		}
+		m.logger.Warn("Another esbuild handler with the same sources and target replaced in the admin API, set an id to tell them apart",
+			zap.String("id", id))
+	}
+	handlers.items[id] = registeredHandler{handler: m, config: ctx.Context}
+	return nil
+}
+
+// unregister leaves the handler alone, when a config reload already provisioned its replacement.
+func (m *Esbuild) unregister() {
+	handlers.lock.Lock()
+	defer handlers.lock.Unlock()
+	if handlers.items[m.handlerID()].handler == m {
+		delete(handlers.items, m.handlerID())
+	}
+}
+
+func (m *Esbuild) status() handlerStatus {
+	sources := []string{}
+	for _, s := range m.Sources {
+		sources = append(sources, s.InputPath)
+	}
+	return handlerStatus{
+		ID:        m.handlerID(),
+		Target:    m.outdir(),
+		Sources:   sources,
+		LastBuild: m.snapshot().status,
+	}
+}
+
+// Interface guards
+var (
+	_ caddy.AdminRouter = (*AdminAPI)(nil)
+)
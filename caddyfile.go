@@ -1,6 +1,7 @@
 package caddy_esbuild_plugin
 
 import (
+	"github.com/caddyserver/caddy/v2"
 	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
 	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
 	"github.com/evanw/esbuild/pkg/api"
@@ -17,9 +18,21 @@ func init() {
 //
 //     esbuild [source]
 //     esbuild ./assets/index.js {
-//        auto_reload
+//        live_reload [sse|websocket]
+//        live_reload_inject bundle|script
+//        log_client_errors
+//        watch <glob...>|off
+//        mode development|production
+//        lazy
+//        debounce 100ms
+//        watch_mode notify|poll|off [interval]
 //        sass
 //        target /_build
+//        id <name>
+//        spa_fallback /app [template]
+//        inject_html [entry...]
+//        transform /src [root]
+//        serve_sources /_sources
 //     }
 //
 //     sass requires cgo to work
@@ -74,6 +87,9 @@ func parseCaddyfileEsbuild(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler,
 			esbuild.FileHash = true
 		case "live_reload":
 			esbuild.LiveReload = true
+			if h.NextArg() {
+				esbuild.LiveReloadTransport = h.Val()
+			}
 		case "scss":
 			if esbuild.hasSassSupport() == false {
 				return nil, h.Err("sass requires caddy to be compiled with CGO and libsass available")
@@ -141,6 +157,86 @@ func parseCaddyfileEsbuild(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler,
 
 			path := h.Val()
 			esbuild.NodePaths = append(esbuild.NodePaths, path)
+		case "spa_fallback":
+			if !h.NextArg() {
+				return nil, h.Err("spa_fallback requires path prefix: spa_fallback /app [./public/index.html]")
+			}
+
+			esbuild.SpaFallback = h.Val()
+			if h.NextArg() {
+				esbuild.SpaTemplate = h.Val()
+			}
+		case "transform":
+			if !h.NextArg() {
+				return nil, h.Err("transform requires path prefix: transform /src [./web]")
+			}
+
+			esbuild.Transform = strings.TrimSuffix(h.Val(), "/")
+			if h.NextArg() {
+				esbuild.TransformRoot = h.Val()
+			}
+		case "serve_sources":
+			if !h.NextArg() {
+				return nil, h.Err("serve_sources requires path prefix: serve_sources /_sources")
+			}
+
+			esbuild.ServeSources = strings.TrimSuffix(h.Val(), "/")
+		case "watch":
+			globs := h.RemainingArgs()
+			if len(globs) == 0 {
+				return nil, h.Err("watch requires at least one glob: watch ./templates/**/*.html")
+			}
+			if len(globs) == 1 && globs[0] == "off" {
+				esbuild.WatchMode = "off"
+			} else {
+				if _, err := compileGlobs(globs); err != nil {
+					return nil, h.Err(err.Error())
+				}
+				esbuild.Watch = append(esbuild.Watch, globs...)
+			}
+		case "live_reload_inject":
+			if !h.NextArg() {
+				return nil, h.Err("live_reload_inject requires a mode: live_reload_inject bundle|script")
+			}
+			esbuild.LiveReloadInject = h.Val()
+		case "debounce":
+			if !h.NextArg() {
+				return nil, h.Err("debounce requires a duration: debounce 100ms")
+			}
+			duration, err := caddy.ParseDuration(h.Val())
+			if err != nil {
+				return nil, h.Errf("invalid debounce duration: %v", err)
+			}
+			esbuild.Debounce = caddy.Duration(duration)
+		case "lazy":
+			esbuild.Lazy = true
+		case "mode":
+			if !h.NextArg() {
+				return nil, h.Err("mode requires a value: mode development|production")
+			}
+			esbuild.Mode = h.Val()
+		case "id":
+			if !h.NextArg() {
+				return nil, h.Err("id requires a name: id app")
+			}
+			esbuild.ID = h.Val()
+		case "watch_mode":
+			if !h.NextArg() {
+				return nil, h.Err("watch_mode requires a mode: watch_mode notify|poll [interval]")
+			}
+			esbuild.WatchMode = h.Val()
+			if h.NextArg() {
+				interval, err := caddy.ParseDuration(h.Val())
+				if err != nil {
+					return nil, h.Errf("invalid poll interval: %v", err)
+				}
+				esbuild.PollInterval = caddy.Duration(interval)
+			}
+		case "log_client_errors":
+			esbuild.LogClientErrors = true
+		case "inject_html":
+			esbuild.InjectHTML = true
+			esbuild.InjectEntries = append(esbuild.InjectEntries, h.RemainingArgs()...)
 		}
 	}
 
@@ -0,0 +1,124 @@
+package caddy_esbuild_plugin
+
+import (
+	"fmt"
+	"github.com/evanw/esbuild/pkg/api"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// inputSignatures records size and mtime of the source files the build read,
+// to tell which modules changed between two builds.
+func inputSignatures(metafile *Metafile) map[string]string {
+	signatures := make(map[string]string)
+	if metafile == nil {
+		return signatures
+	}
+
+	for path := range metafile.Inputs {
+		if strings.Contains(path, "node_modules") || strings.Contains(path, ":") {
+			continue
+		}
+		stat, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		signatures[path] = fmt.Sprintf("%d-%d", stat.Size(), stat.ModTime().UnixNano())
+	}
+	return signatures
+}
+
+// hotModules returns the transformed module urls to hot update, which is
+// only possible when every changed input is served by the transform mode.
+func (m *Esbuild) hotModules(previous map[string]string, current map[string]string) ([]string, bool) {
+	if m.Transform == "" || len(previous) == 0 {
+		return nil, false
+	}
+
+	var modules []string
+	for path, signature := range current {
+		if previous[path] == signature {
+			continue
+		}
+
+		url, ok := m.transformURL(path)
+		if !ok {
+			return nil, false
+		}
+		ext := filepath.Ext(path)
+		if ext != ".css" && !isTransformExtension(ext) {
+			return nil, false
+		}
+		modules = append(modules, url)
+	}
+
+	sort.Strings(modules)
+	return modules, len(modules) > 0
+}
+
+// describeChanges fills in which outputs changed since the previous build, and how clients apply
+// them: "hmr" when only transformed modules changed, "css" when only stylesheets changed, otherwise "reload".
+func (m *Esbuild) describeChanges(event *buildEvent, previous *buildSnapshot, current *buildSnapshot) {
+	for path, hash := range current.hashes {
+		if filepath.Ext(path) != ".map" && previous.hashes[path] != hash {
+			event.Changed = append(event.Changed, path)
+		}
+	}
+	sort.Strings(event.Changed)
+	for name := range current.entriesForOutputs(event.Changed) {
+		event.Entries = append(event.Entries, name)
+	}
+	sort.Strings(event.Entries)
+
+	if modules, ok := m.hotModules(previous.inputs, current.inputs); ok {
+		event.Action = "hmr"
+		event.Modules = modules
+		return
+	}
+	if len(event.Changed) == 0 {
+		event.Action = "none"
+		return
+	}
+
+	var css []cssChange
+	for _, path := range event.Changed {
+		if filepath.Ext(path) != ".css" {
+			event.Action = "reload"
+			return
+		}
+
+		change := cssChange{From: path, To: path}
+		for old := range previous.hashes {
+			if old != path && outputKey(old) == outputKey(path) {
+				change.From = old
+			}
+		}
+		css = append(css, change)
+	}
+
+	event.Action = "css"
+	event.CSS = css
+}
+
+// hashedName matches the [hash] part esbuild adds to file names with file_hash.
+var hashedName = regexp.MustCompile(`-[A-Z0-9]{8}(\.[^./]+)$`)
+
+// outputKey identifies an output independent of its content hash.
+func outputKey(path string) string {
+	return hashedName.ReplaceAllString(path, "$1")
+}
+
+func formatMessages(messages []api.Message) []string {
+	var formatted []string
+	for _, message := range messages {
+		if message.Location != nil {
+			formatted = append(formatted, fmt.Sprintf("%s:%d:%d: %s", message.Location.File, message.Location.Line, message.Location.Column, message.Text))
+		} else {
+			formatted = append(formatted, message.Text)
+		}
+	}
+	return formatted
+}
@@ -0,0 +1,282 @@
+// Live reload client, wrapped in a function receiving `config` by handle_live_reload.go
+if (window.__esbuildLiveReload) {
+  return;
+}
+window.__esbuildLiveReload = true;
+
+// Hot module replacement runtime, behind import.meta.hot in transformed modules
+const hotModules = new Map();
+const hotData = new Map();
+window.__esbuildHmr = {
+  createHotContext(url) {
+    const module = new URL(url, location.href);
+    module.searchParams.delete('t');
+    const path = module.pathname;
+    const hot = {
+      url: module,
+      data: hotData.get(path) || {},
+      accepts: [],
+      disposes: [],
+      accept(callback) {
+        hot.accepts.push(callback || (() => {}));
+      },
+      dispose(callback) {
+        hot.disposes.push(callback);
+      },
+      invalidate() {
+        location.reload();
+      },
+    };
+    hotModules.set(path, hot);
+    return hot;
+  },
+  async apply(modules) {
+    if (!modules.every(path => hotModules.has(path) && hotModules.get(path).accepts.length > 0)) {
+      return false;
+    }
+    for (const path of modules) {
+      const hot = hotModules.get(path);
+      const data = {};
+      hot.disposes.forEach(callback => callback(data));
+      hotData.set(path, data);
+      const url = new URL(hot.url);
+      url.searchParams.set('t', Date.now());
+      const module = await import(url.pathname + url.search);
+      hot.accepts.forEach(callback => callback(module));
+    }
+    return true;
+  },
+};
+
+// Forward browser errors to the Caddy log
+if (config.logErrors) {
+  const describe = value => {
+    if (value instanceof Error) {
+      return value.message;
+    }
+    if (typeof value === 'string') {
+      return value;
+    }
+    try {
+      return JSON.stringify(value);
+    } catch (e) {
+      return String(value);
+    }
+  };
+  const report = (level, message, stack) => {
+    fetch(config.logUrl, {
+      method: 'POST',
+      keepalive: true,
+      headers: {'Content-Type': 'application/json'},
+      body: JSON.stringify({level, message, stack: stack || '', url: location.href}),
+    }).catch(() => {});
+  };
+
+  const consoleError = console.error;
+  console.error = (...args) => {
+    consoleError.apply(console, args);
+    if (typeof args[0] === 'string' && args[0].startsWith('[esbuild]')) {
+      return;
+    }
+    const error = args.find(arg => arg instanceof Error);
+    report('console.error', args.map(describe).join(' '), error && error.stack);
+  };
+  window.addEventListener('error', e => report('error', e.message, e.error && e.error.stack));
+  window.addEventListener('unhandledrejection', e => report('unhandledrejection', describe(e.reason), e.reason && e.reason.stack));
+}
+
+const swapStylesheet = (link, href) => {
+  const next = link.cloneNode();
+  next.href = href;
+  next.addEventListener('load', () => link.remove());
+  next.addEventListener('error', () => next.remove());
+  link.after(next);
+};
+
+// pageOutputs lists the build outputs this page loaded, so the server only sends the builds changing them
+const pageOutputs = () => Array.from(document.querySelectorAll('script[src], link[rel="stylesheet"][href]'))
+  .map(element => new URL(element.src || element.href, location.href))
+  .filter(url => url.origin === location.origin && url.pathname.startsWith(config.outdir + '/'))
+  .map(url => url.pathname);
+
+// connect opens the configured transport and dispatches each event to the handler for its type.
+// onOpen is called once connected, onLost once when the connection drops without calling close.
+// lastEventId is the last build result received, sent when reconnecting to get a missed build replayed
+let lastEventId = 0;
+const received = event => {
+  if (event.id && (event.type === 'build-ok' || event.type === 'build-error')) {
+    lastEventId = event.id;
+  }
+};
+
+const connect = (handlers, onOpen, onLost) => {
+  const outputs = pageOutputs();
+  let closed = false;
+  const lost = () => {
+    if (!closed) {
+      closed = true;
+      onLost();
+    }
+  };
+
+  if (config.transport === 'websocket') {
+    const url = new URL(config.socketUrl, location.href);
+    url.protocol = url.protocol.replace('http', 'ws');
+    url.searchParams.set('outputs', outputs.join(','));
+    if (lastEventId) {
+      url.searchParams.set('last_event_id', lastEventId);
+    }
+    const ws = new WebSocket(url);
+    ws.addEventListener('open', () => {
+      ws.send(JSON.stringify({type: 'hello', outputs}));
+      onOpen();
+    });
+    ws.addEventListener('message', e => {
+      const event = JSON.parse(e.data);
+      handlers[event.type] && handlers[event.type](event);
+      received(event);
+    });
+    ws.addEventListener('close', lost);
+    return {
+      close: () => {
+        closed = true;
+        ws.close();
+      },
+      send: message => ws.readyState === WebSocket.OPEN && ws.send(JSON.stringify(message)),
+    };
+  }
+
+  const url = new URL(config.url, location.href);
+  url.searchParams.set('outputs', outputs.join(','));
+  // EventSource only sends Last-Event-ID when reconnecting by itself, not for a new connection
+  if (lastEventId) {
+    url.searchParams.set('last_event_id', lastEventId);
+  }
+  const es = new EventSource(url);
+  es.addEventListener('open', onOpen);
+  es.addEventListener('error', () => {
+    es.close();
+    lost();
+  });
+  for (const type of Object.keys(handlers)) {
+    es.addEventListener(type, e => {
+      const event = JSON.parse(e.data);
+      handlers[type](event);
+      received(event);
+    });
+  }
+  return {
+    close: () => {
+      closed = true;
+      es.close();
+    },
+    send: () => false,
+  };
+};
+
+// badge shows the connection and build state in the corner of the page
+let badgeElement;
+let badgeTimeout;
+const badgeColors = {connected: '#2e7d32', building: '#f9a825', failed: '#c62828', disconnected: '#757575'};
+const badge = (state, title) => {
+  if (!document.body) {
+    return;
+  }
+  if (!badgeElement) {
+    badgeElement = document.createElement('div');
+    badgeElement.setAttribute('aria-hidden', 'true');
+    Object.assign(badgeElement.style, {
+      position: 'fixed',
+      right: '8px',
+      bottom: '8px',
+      zIndex: '2147483647',
+      padding: '2px 8px',
+      borderRadius: '8px',
+      font: '11px/16px sans-serif',
+      color: '#fff',
+      opacity: '0.85',
+    });
+    document.body.appendChild(badgeElement);
+  }
+  badgeElement.textContent = 'esbuild: ' + state;
+  badgeElement.title = title || '';
+  badgeElement.style.background = badgeColors[state];
+  badgeElement.style.display = '';
+
+  clearTimeout(badgeTimeout);
+  if (state === 'connected') {
+    badgeTimeout = setTimeout(() => badgeElement.style.display = 'none', 2000);
+  }
+};
+
+const applyBuild = build => {
+  switch (build.action) {
+    case 'reload':
+      connection.close();
+      location.reload();
+      break;
+    case 'css':
+      for (const link of document.querySelectorAll('link[rel="stylesheet"]')) {
+        const path = new URL(link.href, location.href).pathname;
+        const change = build.css.find(c => c.from === path || c.to === path);
+        if (change) {
+          swapStylesheet(link, change.to + '?t=' + Date.now());
+        }
+      }
+      break;
+    case 'hmr':
+      window.__esbuildHmr.apply(build.modules)
+        .catch(err => console.error('[esbuild] hot update failed', err) || false)
+        .then(applied => applied || location.reload());
+      break;
+  }
+};
+
+let connection;
+let attempt = 0;
+let disconnected = false;
+// replaying is set after reconnecting, the server first sends the last build result when it was missed
+let replaying = false;
+const start = () => {
+  connection = connect({
+    'build-start': () => {
+      replaying = false;
+      badge('building');
+    },
+    'build-ok': build => {
+      badge('connected');
+      if (replaying) {
+        // Builds were missed while disconnected, the action only describes the last one
+        location.reload();
+        return;
+      }
+      applyBuild(build);
+    },
+    'build-error': build => {
+      replaying = false;
+      badge('failed', build.errors.join('\n'));
+      build.errors.forEach(error => console.error('[esbuild] ' + error));
+    },
+    'reload': () => applyBuild({action: 'reload'}),
+  }, () => {
+    // Without any build result seen there is nothing to replay, and the page may be outdated
+    if (disconnected && !lastEventId) {
+      location.reload();
+      return;
+    }
+    replaying = disconnected;
+    attempt = 0;
+    badge('connected');
+  }, () => {
+    disconnected = true;
+    badge('disconnected');
+    setTimeout(start, Math.min(30000, 500 * Math.pow(2, attempt++)));
+  });
+};
+
+// Wait for the whole document, so every script and stylesheet of the page is known
+if (document.readyState === 'loading') {
+  document.addEventListener('DOMContentLoaded', start);
+} else {
+  start();
+}
@@ -0,0 +1,132 @@
+package caddy_esbuild_plugin
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// debouncer runs a function once no new trigger arrived within the window.
+// Without a window every trigger runs immediately.
+type debouncer struct {
+	lock   sync.Mutex
+	window time.Duration
+	timer  *time.Timer
+}
+
+func (d *debouncer) trigger(fn func()) {
+	if d.window <= 0 {
+		fn()
+		return
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+	d.timer = time.AfterFunc(d.window, fn)
+}
+
+func (d *debouncer) stop() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+}
+
+// eventBuffer holds the live reload event merged from everything within the debounce window.
+type eventBuffer struct {
+	debouncer
+	pendingLock sync.Mutex
+	pending     *buildEvent
+}
+
+// scheduleRebuild coalesces rebuild requests from the sass imports and polling into a single rebuild.
+// esbuild's own watcher rebuilds without it.
+func (m *Esbuild) scheduleRebuild() {
+	m.rebuildDebounce.trigger(func() {
+		m.builds.request(false)
+	})
+}
+
+// publishDebounced merges the build results and reloads within the debounce
+// window into a single live reload event.
+func (m *Esbuild) publishDebounced(event buildEvent) {
+	buffer := m.eventDebounce
+	buffer.pendingLock.Lock()
+	buffer.pending = mergeEvents(buffer.pending, event)
+	buffer.pendingLock.Unlock()
+
+	buffer.trigger(func() {
+		buffer.pendingLock.Lock()
+		pending := buffer.pending
+		buffer.pending = nil
+		buffer.pendingLock.Unlock()
+
+		if pending != nil {
+			m.hub.publish(*pending)
+		}
+	})
+}
+
+// mergeEvents combines two successive build results, or watched file reloads.
+// Anything but a successful build or reload simply replaces what was pending.
+func mergeEvents(previous *buildEvent, next buildEvent) *buildEvent {
+	mergeable := func(event buildEvent) bool {
+		return event.Type == "build-ok" || event.Type == "reload"
+	}
+	if previous == nil || !mergeable(*previous) || !mergeable(next) {
+		return &next
+	}
+
+	merged := next
+	if previous.Type == "build-ok" {
+		merged.Type = "build-ok"
+		merged.ID = previous.ID
+		if next.ID > merged.ID {
+			merged.ID = next.ID
+		}
+	}
+	merged.Changed = union(previous.Changed, next.Changed)
+	merged.Entries = union(previous.Entries, next.Entries)
+	merged.Duration = previous.Duration + next.Duration
+
+	switch {
+	case previous.Type == "reload" || next.Type == "reload":
+		merged.Action = "reload"
+	case previous.Action == "none":
+		merged.Action = next.Action
+	case next.Action == "none":
+		merged.Action = previous.Action
+	case previous.Action != next.Action:
+		merged.Action = "reload"
+	}
+
+	merged.CSS = nil
+	merged.Modules = nil
+	switch merged.Action {
+	case "css":
+		merged.CSS = append(previous.CSS, next.CSS...)
+	case "hmr":
+		merged.Modules = union(previous.Modules, next.Modules)
+	}
+	if merged.Type == "reload" {
+		merged.Action = ""
+	}
+	return &merged
+}
+
+func union(a []string, b []string) []string {
+	seen := make(map[string]bool)
+	var result []string
+	for _, value := range append(append([]string{}, a...), b...) {
+		if !seen[value] {
+			seen[value] = true
+			result = append(result, value)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
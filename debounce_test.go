@@ -0,0 +1,63 @@
+package caddy_esbuild_plugin
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergeEvents(t *testing.T) {
+	tests := []struct {
+		name     string
+		previous *buildEvent
+		next     buildEvent
+		want     buildEvent
+	}{
+		{
+			name: "first event",
+			next: buildEvent{ID: 1, Type: "build-ok", Action: "css"},
+			want: buildEvent{ID: 1, Type: "build-ok", Action: "css"},
+		},
+		{
+			name:     "error replaces a pending build",
+			previous: &buildEvent{ID: 1, Type: "build-ok", Action: "css"},
+			next:     buildEvent{ID: 2, Type: "build-error", Errors: []string{"failed"}},
+			want:     buildEvent{ID: 2, Type: "build-error", Errors: []string{"failed"}},
+		},
+		{
+			name:     "same action",
+			previous: &buildEvent{ID: 1, Type: "build-ok", Action: "hmr", Modules: []string{"/src/b.ts"}, Entries: []string{"app"}, Duration: 2},
+			next:     buildEvent{ID: 2, Type: "build-ok", Action: "hmr", Modules: []string{"/src/a.ts", "/src/b.ts"}, Duration: 3},
+			want:     buildEvent{ID: 2, Type: "build-ok", Action: "hmr", Modules: []string{"/src/a.ts", "/src/b.ts"}, Entries: []string{"app"}, Duration: 5},
+		},
+		{
+			name:     "nothing to do keeps the other action",
+			previous: &buildEvent{ID: 1, Type: "build-ok", Action: "css", CSS: []cssChange{{From: "/_build/a.css", To: "/_build/a.css"}}},
+			next:     buildEvent{ID: 2, Type: "build-ok", Action: "none"},
+			want:     buildEvent{ID: 2, Type: "build-ok", Action: "css", CSS: []cssChange{{From: "/_build/a.css", To: "/_build/a.css"}}},
+		},
+		{
+			name:     "different actions reload",
+			previous: &buildEvent{ID: 1, Type: "build-ok", Action: "css", CSS: []cssChange{{From: "/_build/a.css", To: "/_build/a.css"}}},
+			next:     buildEvent{ID: 2, Type: "build-ok", Action: "hmr", Modules: []string{"/src/a.ts"}},
+			want:     buildEvent{ID: 2, Type: "build-ok", Action: "reload"},
+		},
+		{
+			name:     "watched file after a build",
+			previous: &buildEvent{ID: 1, Type: "build-ok", Action: "css"},
+			next:     buildEvent{Type: "reload", Changed: []string{"index.html"}},
+			want:     buildEvent{ID: 1, Type: "build-ok", Action: "reload", Changed: []string{"index.html"}},
+		},
+		{
+			name:     "watched files",
+			previous: &buildEvent{Type: "reload", Changed: []string{"b.html"}},
+			next:     buildEvent{Type: "reload", Changed: []string{"a.html", "b.html"}},
+			want:     buildEvent{Type: "reload", Changed: []string{"a.html", "b.html"}},
+		},
+	}
+	for _, test := range tests {
+		got := mergeEvents(test.previous, test.next)
+		if !reflect.DeepEqual(*got, test.want) {
+			t.Errorf("%s: mergeEvents() = %+v, want %+v", test.name, *got, test.want)
+		}
+	}
+}
@@ -3,10 +3,11 @@ package caddy_esbuild_plugin
 import (
 	"crypto/sha1"
 	"encoding/hex"
-	"encoding/json"
 	"fmt"
 	"github.com/evanw/esbuild/pkg/api"
 	"go.uber.org/zap"
+	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -14,19 +15,29 @@ type Process struct {
 	Env map[string]string `json:"env"`
 }
 
-func (m *Esbuild) initEsbuild() {
-	var inject []string
+// initEsbuild starts a fresh build. Without watching the build is not kept
+// around for incremental rebuilds, and failing to build is an error.
+// Only the scheduler calls it, the timing plugin publishes the result.
+func (m *Esbuild) initEsbuild() error {
+	var banner map[string]string
 	var plugins []api.Plugin
 
-	plugins = append(plugins, m.createTimingPlugin())
+	// Defines are fixed for the lifetime of an incremental build, and kept in its snapshot
+	defines := make(map[string]string)
+	if m.Env {
+		defines = m.handleEnv()
+	}
+	for key, val := range m.Defines {
+		defines[key] = val
+	}
 
-	if m.LiveReload {
-		name, err := m.createAutoloadShimFile()
-		if err != nil {
-			m.logger.Error("Failed to create autoload shim", zap.Error(err))
-		} else {
-			inject = append(inject, name)
-		}
+	m.builds.building.Lock()
+	generation := atomic.AddInt64(&m.generation, 1)
+	m.builds.building.Unlock()
+	plugins = append(plugins, m.createTimingPlugin(generation, defines))
+
+	if m.LiveReload && m.liveReloadInject() == "bundle" {
+		banner = map[string]string{"js": m.liveReloadClient()}
 	}
 
 	if m.Scss {
@@ -38,11 +49,6 @@ func (m *Esbuild) initEsbuild() {
 		}
 	}
 
-	if m.Env {
-		m.handleEnv()
-	}
-
-	start := time.Now()
 	loader := map[string]api.Loader{}
 	for ext, l := range m.Loader {
 		parseLoader, _ := ParseLoader(l)
@@ -54,9 +60,12 @@ func (m *Esbuild) initEsbuild() {
 		entryName = "[name]-[hash]"
 	}
 
-	outdir := m.Target
-	if outdir == "" {
-		outdir = "/_build"
+	outdir := m.outdir()
+
+	// Polling triggers the rebuilds itself
+	var watch *api.WatchMode
+	if m.watchMode() == "notify" {
+		watch = &api.WatchMode{}
 	}
 
 	result := api.Build(api.BuildOptions{
@@ -66,61 +75,93 @@ func (m *Esbuild) initEsbuild() {
 		Outdir:              outdir,
 		EntryNames:          entryName,
 		PublicPath:          outdir,
-		Define:              m.Defines,
+		Define:              defines,
 		Metafile:            true,
 		Write:               false,
 		Bundle:              true,
-		Inject:              inject,
+		Banner:              banner,
 		JSXMode:             api.JSXModeTransform,
 		Plugins:             plugins,
-		Incremental:         true,
+		Incremental:         m.watchMode() != "off",
 		Loader:              loader,
-		Watch: &api.WatchMode{
-			OnRebuild: func(result api.BuildResult) {
-				m.logger.Debug("Rebuild completed!")
-				m.onBuild(result, m.lastDuration)
-			},
-		},
+		Watch:               watch,
 	})
-	duration := time.Now().Sub(start)
-	m.onBuild(result, &duration)
+
+	// Only the first build of an esbuild context can stop its watcher
+	if result.Stop != nil {
+		m.builds.watching(result.Stop)
+	}
+
+	if m.watchMode() == "off" && len(result.Errors) > 0 {
+		return fmt.Errorf("esbuild failed: %s", strings.Join(formatMessages(result.Errors), "; "))
+	}
+	return nil
 }
 
-func (m *Esbuild) onBuild(result api.BuildResult, duration *time.Duration) {
+func (m *Esbuild) onBuild(result api.BuildResult, id int64, duration *time.Duration, defines map[string]string) {
+	if m.ServeSources != "" && len(result.Errors) == 0 {
+		m.rewriteSourceMaps(&result)
+	}
 
-	m.esbuild = &result
 	for _, err := range result.Errors {
 		m.logger.Error(err.Text)
 	}
 
-	for _, f := range result.OutputFiles {
-		m.logger.Debug("Built file", zap.String("file", f.Path))
-		hasher := sha1.New()
-		hasher.Write(f.Contents)
-		m.hashes[f.Path] = hex.EncodeToString(hasher.Sum(nil))
+	event := buildEvent{
+		ID:       id,
+		Type:     "build-ok",
+		Warnings: formatMessages(result.Warnings),
+		Errors:   formatMessages(result.Errors),
+		Duration: duration.Milliseconds(),
+	}
+
+	previous := m.snapshot()
+	current := m.newSnapshot(&result, defines, previous, newBuildStatus(event))
+	m.current.Store(current)
+	if m.pollMode() {
+		m.watchFiles(m.pollInputs(&result, current))
 	}
+
 	if len(result.Errors) > 0 {
 		m.logger.Error(fmt.Sprintf("watch build failed: %d errors\n", len(result.Errors)))
+		event.Type = "build-error"
+		m.publishDebounced(event)
 		return
 	} else {
-		m.logger.Info(fmt.Sprintf("watch build succeeded in %dms: %d warnings\n", duration.Milliseconds(), len(result.Warnings)))
+		m.logger.Info(fmt.Sprintf("watch build succeeded in %dms: %d warnings\n", duration.Milliseconds(), len(result.Warnings)),
+			zap.Int("live_reload_clients", m.hub.count()))
 	}
 
-	var metafile = Metafile{}
-	if err := json.Unmarshal([]byte(m.esbuild.Metafile), &metafile); err != nil {
-		m.logger.Error("Failed to build manifest.json", zap.Error(err))
-	} else {
-		m.metafile = &metafile
-	}
+	m.describeChanges(&event, previous, current)
+	m.publishDebounced(event)
 }
 
+// Rebuild schedules a rebuild and waits until it finished.
 func (m *Esbuild) Rebuild() {
-	if m.esbuild != nil {
-		start := time.Now()
-		result := m.esbuild.Rebuild()
-		duration := time.Now().Sub(start)
-		m.onBuild(result, &duration)
+	if m.snapshot().result == nil {
+		_ = m.build()
+		return
 	}
+	_ = m.builds.wait(m.builds.request(false))
+}
+
+// runBuild is called by the scheduler, one build at a time.
+func (m *Esbuild) runBuild(fresh bool) error {
+	b := m.snapshot()
+	if fresh || b.result == nil || b.result.Rebuild == nil {
+		m.builds.stopWatching()
+		return m.initEsbuild()
+	}
+
+	b.result.Rebuild()
+	return nil
+}
+
+// hashContents is used as ETag for everything served from memory.
+func hashContents(contents []byte) string {
+	hasher := sha1.New()
+	hasher.Write(contents)
+	return hex.EncodeToString(hasher.Sum(nil))
 }
 
 func ParseLoader(text string) (api.Loader, error) {
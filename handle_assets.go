@@ -7,17 +7,19 @@ import (
 	"mime"
 	"net/http"
 	"path/filepath"
+	"strings"
 )
 
-func (m *Esbuild) handleAsset(w http.ResponseWriter, r *http.Request, f api.OutputFile) error {
+func (m *Esbuild) handleAsset(w http.ResponseWriter, r *http.Request, b *buildSnapshot, f api.OutputFile) error {
 	cachedETag := r.Header.Get("If-None-Match")
-	if cachedETag == m.hashes[f.Path] {
+	if cachedETag == b.hashes[f.Path] {
 		w.WriteHeader(304) //No change
 		return nil
 	}
 
-	w.Header().Set("ETag", m.hashes[f.Path])
+	w.Header().Set("ETag", b.hashes[f.Path])
 	w.Header().Set("Content-type", guessContentType(f.Path))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
 
 	if m.FileHash {
 		w.Header().Set("Cache-Control", "public,max-age=31536000")
@@ -29,13 +31,42 @@ func (m *Esbuild) handleAsset(w http.ResponseWriter, r *http.Request, f api.Outp
 	return nil
 }
 
+// contentTypes covers everything esbuild can emit, so the result does not
+// depend on the mime database of the host.
+var contentTypes = map[string]string{
+	".js":    "application/javascript; charset=utf-8",
+	".mjs":   "application/javascript; charset=utf-8",
+	".cjs":   "application/javascript; charset=utf-8",
+	".css":   "text/css; charset=utf-8",
+	".map":   "application/json; charset=utf-8",
+	".json":  "application/json; charset=utf-8",
+	".wasm":  "application/wasm",
+	".woff":  "font/woff",
+	".woff2": "font/woff2",
+	".ttf":   "font/ttf",
+	".otf":   "font/otf",
+	".eot":   "application/vnd.ms-fontobject",
+	".png":   "image/png",
+	".jpg":   "image/jpeg",
+	".jpeg":  "image/jpeg",
+	".gif":   "image/gif",
+	".svg":   "image/svg+xml",
+	".webp":  "image/webp",
+	".avif":  "image/avif",
+	".ico":   "image/x-icon",
+	".txt":   "text/plain; charset=utf-8",
+	".html":  "text/html; charset=utf-8",
+}
+
 func guessContentType(path string) string {
-	ext := filepath.Ext(path)
-	contentType := mime.TypeByExtension(ext)
+	ext := strings.ToLower(filepath.Ext(path))
+	if contentType, ok := contentTypes[ext]; ok {
+		return contentType
+	}
 
-	if contentType != "" {
+	if contentType := mime.TypeByExtension(ext); contentType != "" {
 		return contentType
 	}
 
-	return "application/javascript"
+	return "application/octet-stream"
 }
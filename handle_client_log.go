@@ -0,0 +1,106 @@
+package caddy_esbuild_plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// clientLog is an error reported by the live reload client.
+type clientLog struct {
+	Level   string `json:"level"`
+	Message string `json:"message"`
+	Stack   string `json:"stack"`
+	URL     string `json:"url"`
+}
+
+// stackLocation matches the url:line:column of a stack frame in both Chrome and Firefox.
+var stackLocation = regexp.MustCompile(`(https?://[^\s()@]+):(\d+):(\d+)`)
+
+func (m *Esbuild) handleClientLog(w http.ResponseWriter, r *http.Request) error {
+	var entry clientLog
+	if err := json.NewDecoder(io.LimitReader(r.Body, 64*1024)).Decode(&entry); err != nil {
+		w.WriteHeader(400)
+		return nil
+	}
+
+	m.logger.Error("Browser error",
+		zap.String("level", entry.Level),
+		zap.String("message", entry.Message),
+		zap.String("page", entry.URL),
+		zap.String("stack", m.resolveStack(entry.Stack)),
+		zap.String("user_agent", r.UserAgent()))
+
+	w.WriteHeader(204)
+	return nil
+}
+
+// resolveStack rewrites the locations in a stack trace that point into
+// built files to the original sources, using the in-memory source maps.
+func (m *Esbuild) resolveStack(stack string) string {
+	b := m.snapshot()
+	if b.result == nil {
+		return stack
+	}
+
+	maps := make(map[string]*sourceMap)
+	return stackLocation.ReplaceAllStringFunc(stack, func(location string) string {
+		groups := stackLocation.FindStringSubmatch(location)
+		u, err := url.Parse(groups[1])
+		if err != nil {
+			return location
+		}
+
+		sm, ok := maps[u.Path]
+		if !ok {
+			sm = m.findSourceMap(b, u.Path+".map")
+			maps[u.Path] = sm
+		}
+		if sm == nil {
+			return location
+		}
+
+		line, _ := strconv.Atoi(groups[2])
+		column, _ := strconv.Atoi(groups[3])
+		source, sourceLine, sourceColumn, ok := sm.lookup(line-1, column-1)
+		if !ok {
+			return location
+		}
+		return fmt.Sprintf("%s:%d:%d", m.displaySource(u.Path, source), sourceLine+1, sourceColumn+1)
+	})
+}
+
+func (m *Esbuild) findSourceMap(b *buildSnapshot, path string) *sourceMap {
+	f, ok := b.routes[path]
+	if !ok {
+		return nil
+	}
+	sm, err := parseSourceMap(f.Contents)
+	if err != nil {
+		m.logger.Debug("Failed to parse source map", zap.Error(err), zap.String("file", path))
+		return nil
+	}
+	return sm
+}
+
+// displaySource turns a source map source into a path relative to the working directory.
+func (m *Esbuild) displaySource(output string, source string) string {
+	if m.ServeSources != "" && strings.HasPrefix(source, m.ServeSources+"/") {
+		return strings.TrimPrefix(source, m.ServeSources+"/")
+	}
+
+	cwd, _ := os.Getwd()
+	abs := filepath.Join(filepath.Dir(output), filepath.FromSlash(source))
+	if rel, err := filepath.Rel(cwd, abs); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return source
+}
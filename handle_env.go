@@ -7,29 +7,59 @@ import (
 	"strings"
 )
 
-func (m *Esbuild) handleEnv() {
-	process := Process{Env: map[string]string{}}
+// envFiles lists the env files by priority, the first file defining a variable wins.
+func envFiles() []string {
 	currentEnv := os.Getenv("NODE_ENV")
 	if currentEnv == "" {
 		currentEnv = "development"
 	}
+	return []string{".env." + currentEnv + ".local", ".env.local", ".env." + currentEnv, ".env"}
+}
 
-	_ = godotenv.Load(".env." + currentEnv + ".local")
-	_ = godotenv.Load(".env.local")
-	_ = godotenv.Load(".env." + currentEnv)
-	err := godotenv.Load()
-
-	process.Env["NODE_ENV"] = os.Getenv("NODE_ENV")
-	if err != nil {
-		m.logger.Error("Failed to load env", zap.Error(err))
-	} else {
-		for _, pair := range os.Environ() {
-			item := strings.SplitN(pair, "=", 2)
-			key := item[0]
-			val := item[1]
-
-			val = strings.ReplaceAll(val, "\"", "\\\"")
-			m.Defines["process.env."+key] = "\"" + val + "\""
+// handleEnv reads the env files without touching the process environment,
+// so they can be read again when they change, and returns them as defines.
+func (m *Esbuild) handleEnv() map[string]string {
+	env := map[string]string{}
+	for _, file := range envFiles() {
+		values, err := godotenv.Read(file)
+		if os.IsNotExist(err) {
+			continue
 		}
+		if err != nil {
+			m.logger.Error("Failed to load env", zap.Error(err), zap.String("file", file))
+			continue
+		}
+		for key, val := range values {
+			if _, ok := env[key]; !ok {
+				env[key] = val
+			}
+		}
+	}
+	for _, pair := range os.Environ() {
+		item := strings.SplitN(pair, "=", 2)
+		env[item[0]] = item[1]
 	}
+
+	defines := make(map[string]string)
+	for key, val := range env {
+		val = strings.ReplaceAll(val, "\"", "\\\"")
+		defines["process.env."+key] = "\"" + val + "\""
+	}
+	return defines
+}
+
+// watchEnv starts a fresh build with the new defines whenever an env file changes.
+func (m *Esbuild) watchEnv() {
+	m.watcher.add(envFiles(), func(file string) {
+		m.logger.Debug("Env file changed, rebuilding", zap.String("filename", file))
+		m.envDebounce.trigger(func() {
+			m.reloadEnv(file)
+		})
+	})
+}
+
+// reloadEnv replaces the incremental build, as the defines are fixed for its lifetime.
+func (m *Esbuild) reloadEnv(file string) {
+	_ = m.builds.wait(m.builds.request(true))
+	m.publishDebounced(buildEvent{Type: "reload", Changed: []string{file}})
 }
@@ -0,0 +1,98 @@
+package caddy_esbuild_plugin
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"net/http"
+	"strings"
+)
+
+func (m *Esbuild) serveInjected(w http.ResponseWriter, r *http.Request, h caddyhttp.Handler) error {
+	// The tags depend on the current build, so downstream must never answer a page with a 304,
+	// and the response must come back uncompressed for us to rewrite it.
+	// Assets keep their conditional requests and compression.
+	r = r.Clone(r.Context())
+	if strings.Contains(r.Header.Get("Accept"), "text/html") {
+		r.Header.Del("If-None-Match")
+		r.Header.Del("If-Modified-Since")
+		r.Header.Del("Accept-Encoding")
+	}
+
+	buf := new(bytes.Buffer)
+	rec := caddyhttp.NewResponseRecorder(w, buf, func(status int, header http.Header) bool {
+		return status == http.StatusOK &&
+			header.Get("Content-Encoding") == "" &&
+			strings.HasPrefix(header.Get("Content-Type"), "text/html")
+	})
+
+	if err := h.ServeHTTP(rec, r); err != nil {
+		return err
+	}
+	// Nothing was written when no handler answered the request
+	if !rec.Buffered() || rec.Status() == 0 {
+		return rec.WriteResponse()
+	}
+
+	body := m.injectTags(buf.Bytes())
+	w.Header().Del("Content-Length")
+	w.Header().Del("ETag")
+	w.Header().Del("Last-Modified")
+	w.WriteHeader(rec.Status())
+	_, err := w.Write(body)
+	return err
+}
+
+func (m *Esbuild) injectTags(body []byte) []byte {
+	var styles, scripts strings.Builder
+	for _, entry := range m.snapshot().entries {
+		if !m.shouldInject(entry.Name) {
+			continue
+		}
+		if entry.CSS != "" && !bytes.Contains(body, []byte(entry.CSS)) {
+			styles.WriteString(fmt.Sprintf("<link rel=\"stylesheet\" href=\"%s\">\n", entry.CSS))
+		}
+		if entry.JS != "" && !bytes.Contains(body, []byte(entry.JS)) {
+			scripts.WriteString(fmt.Sprintf("<script src=\"%s\"></script>\n", entry.JS))
+		}
+	}
+	if m.LiveReload {
+		scripts.WriteString(fmt.Sprintf("<script src=\"%s/__livereload.js\"></script>\n", m.outdir()))
+	}
+
+	body = insertBefore(body, "</head>", styles.String())
+	return insertBefore(body, "</body>", scripts.String())
+}
+
+func (m *Esbuild) shouldInject(name string) bool {
+	if len(m.InjectEntries) == 0 {
+		return true
+	}
+	for _, entry := range m.InjectEntries {
+		if entry == name {
+			return true
+		}
+	}
+	return false
+}
+
+// insertBefore inserts the content in front of the last occurrence of tag,
+// or appends it when the document does not contain the tag.
+func insertBefore(body []byte, tag string, content string) []byte {
+	if content == "" {
+		return body
+	}
+
+	index := bytes.LastIndex(body, []byte(tag))
+	if index < 0 {
+		index = bytes.LastIndex(body, []byte(strings.ToUpper(tag)))
+	}
+	if index < 0 {
+		return append(body, content...)
+	}
+
+	result := make([]byte, 0, len(body)+len(content))
+	result = append(result, body[:index]...)
+	result = append(result, content...)
+	return append(result, body[index:]...)
+}
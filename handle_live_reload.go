@@ -1,15 +1,19 @@
 package caddy_esbuild_plugin
 
 import (
+	_ "embed"
+	"encoding/json"
 	"fmt"
-	"io/ioutil"
+	"go.uber.org/zap"
 	"net/http"
-	"os"
-	"os/signal"
-	"syscall"
+	"strconv"
+	"strings"
 	"time"
 )
 
+//go:embed client/livereload.js
+var liveReloadScript string
+
 func (m *Esbuild) handleLiveReload(w http.ResponseWriter, r *http.Request) error {
 	// Add headers needed for server-sent events (SSE):
 	w.Header().Set("Content-Type", "text/event-stream")
@@ -19,53 +23,81 @@ func (m *Esbuild) handleLiveReload(w http.ResponseWriter, r *http.Request) error
 	if !ok {
 		m.logger.Debug("Your browser does not support server-sent events (SSE).")
 		return nil
-	} else {
-		m.logger.Debug("LiveReload started")
 	}
 
-	var lastPointer = m.esbuild
-	sigs := make(chan os.Signal, 1)
-	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	// The browser sends the header when reconnecting by itself, the client passes it along for new connections
+	lastEventID, _ := strconv.ParseInt(r.Header.Get("Last-Event-ID"), 10, 64)
+	if lastEventID == 0 {
+		lastEventID, _ = strconv.ParseInt(r.URL.Query().Get("last_event_id"), 10, 64)
+	}
+	entries := m.snapshot().entriesForOutputs(strings.Split(r.URL.Query().Get("outputs"), ","))
+	events, clients := m.hub.subscribe(lastEventID, entries)
+	m.logger.Debug("LiveReload connected", zap.Int("clients", clients), zap.Int("entries", len(entries)))
+	defer func() {
+		clients := m.hub.unsubscribe(events)
+		m.logger.Debug("LiveReload disconnected", zap.Int("clients", clients))
+	}()
+
+	w.WriteHeader(200)
+	flusher.Flush()
+
+	ping := time.NewTicker(10 * time.Second)
+	defer ping.Stop()
 
 	for {
-		compareTimeout := time.After(20 * time.Millisecond)
-		pingTimeout := time.After(10 * time.Second)
 		select {
 		case <-r.Context().Done():
 			return nil
-		case <-m.globalQuit:
-			return nil
-		case <-sigs:
-			return nil
-		case <-compareTimeout:
-			var currentPointer = m.esbuild
-			if lastPointer != currentPointer {
-				_, _ = fmt.Fprintf(w, "data: reload\n\n")
-				flusher.Flush()
-				lastPointer = m.esbuild
+		case event, ok := <-events:
+			if !ok {
+				return nil
 			}
-		case <-pingTimeout:
-			_, _ = fmt.Fprintf(w, "data: p\n\n")
+			event.writeSSE(w)
+			flusher.Flush()
+		case <-ping.C:
+			buildEvent{Type: "ping"}.writeSSE(w)
 			flusher.Flush()
 		}
 	}
 }
 
-func (m *Esbuild) createAutoloadShimFile() (string, error) {
+// liveReloadClient returns the browser side of live reload. It may end up on
+// a page more than once, through bundles and injected tags, but only connects once.
+func (m *Esbuild) liveReloadClient() string {
+	config, _ := json.Marshal(map[string]interface{}{
+		"url":       m.outdir() + "/__livereload",
+		"socketUrl": m.outdir() + "/__livereload_ws",
+		"transport": m.LiveReloadTransport,
+		"logUrl":    m.outdir() + "/__log",
+		"logErrors": m.LogClientErrors,
+		"outdir":    m.outdir(),
+	})
+	return fmt.Sprintf("(config => {\n%s})(%s);\n", liveReloadScript, config)
+}
 
-	outdir := m.Target
-	if outdir == "" {
-		outdir = "/_build"
-	}
-	livereload := "(() => {const es = new EventSource('%s/__livereload'); es.addEventListener('message', e => e.data === 'reload' && (es.close() || location.reload()))})()"
-	file, err := ioutil.TempFile(os.TempDir(), "caddy-esbuild-shim-*.js")
-	if err != nil {
-		return "", fmt.Errorf("autoload: failed to create tmpfile: %s", err)
+// handleLiveReloadClient serves the client on its own, for pages that do not get it through a bundle.
+func (m *Esbuild) handleLiveReloadClient(w http.ResponseWriter, r *http.Request) error {
+	client := []byte(m.liveReloadClient())
+	etag := hashContents(client)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(304) //No change
+		return nil
 	}
-	_, err = file.Write([]byte(fmt.Sprintf(livereload, outdir)))
-	if err != nil {
-		return "", fmt.Errorf("autoload: failed to write shim: %s", err)
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Content-Type", guessContentType(".js"))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(200)
+	_, _ = w.Write(client)
+	return nil
+}
+
+// liveReloadInject is how the client gets on the page: "bundle" adds it as banner to every js
+// output, "script" only serves it from /<target>/__livereload.js.
+func (m *Esbuild) liveReloadInject() string {
+	if m.LiveReloadInject == "" {
+		return "bundle"
 	}
-	name := file.Name()
-	return name, nil
+	return m.LiveReloadInject
 }
@@ -0,0 +1,107 @@
+package caddy_esbuild_plugin
+
+import (
+	"fmt"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"go.uber.org/zap"
+	"golang.org/x/net/websocket"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// clientMessage is sent by the live reload client over the WebSocket transport.
+// A "hello" message announces the Outputs the page loaded.
+type clientMessage struct {
+	Type    string   `json:"type"`
+	Outputs []string `json:"outputs,omitempty"`
+}
+
+func (m *Esbuild) handleLiveReloadSocket(w http.ResponseWriter, r *http.Request) error {
+	// x/net panics when it cannot take over the connection, like for HTTP/2 requests
+	_, ok := w.(http.Hijacker)
+	if !ok || r.ProtoMajor != 1 || !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		return caddyhttp.Error(http.StatusBadRequest, fmt.Errorf("not a websocket upgrade"))
+	}
+
+	server := websocket.Server{
+		// Unlike server-sent events, browsers allow any page to open a WebSocket,
+		// so only pages of this host may read the builds. Other clients send no Origin.
+		Handshake: func(config *websocket.Config, r *http.Request) error {
+			origin, err := websocket.Origin(config, r)
+			if err != nil {
+				return err
+			}
+			if origin != nil && origin.Host != r.Host {
+				return fmt.Errorf("origin %s is not allowed", origin.Host)
+			}
+			config.Origin = origin
+			return nil
+		},
+		Handler: func(ws *websocket.Conn) {
+			m.serveLiveReloadSocket(ws, r)
+		},
+	}
+	server.ServeHTTP(w, r)
+	return nil
+}
+
+// serveLiveReloadSocket sends the same events as the server-sent event stream, as json messages.
+func (m *Esbuild) serveLiveReloadSocket(ws *websocket.Conn, r *http.Request) {
+	defer ws.Close()
+
+	lastEventID, _ := strconv.ParseInt(r.URL.Query().Get("last_event_id"), 10, 64)
+	entries := m.snapshot().entriesForOutputs(strings.Split(r.URL.Query().Get("outputs"), ","))
+	events, clients := m.hub.subscribe(lastEventID, entries)
+	m.logger.Debug("LiveReload connected", zap.Int("clients", clients), zap.Int("entries", len(entries)), zap.String("transport", "websocket"))
+	defer func() {
+		clients := m.hub.unsubscribe(events)
+		m.logger.Debug("LiveReload disconnected", zap.Int("clients", clients), zap.String("transport", "websocket"))
+	}()
+
+	done := make(chan struct{})
+	defer close(done)
+	messages := make(chan clientMessage)
+	go func() {
+		defer close(messages)
+		for {
+			var message clientMessage
+			if err := websocket.JSON.Receive(ws, &message); err != nil {
+				return
+			}
+			select {
+			case messages <- message:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(10 * time.Second)
+	defer ping.Stop()
+
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if err := websocket.JSON.Send(ws, event); err != nil {
+				return
+			}
+		case <-ping.C:
+			if err := websocket.JSON.Send(ws, buildEvent{Type: "ping"}); err != nil {
+				return
+			}
+		case message, ok := <-messages:
+			if !ok {
+				return
+			}
+			m.logger.Debug("LiveReload message", zap.String("type", message.Type))
+			if message.Type == "hello" {
+				m.hub.filter(events, m.snapshot().entriesForOutputs(message.Outputs))
+			}
+		}
+	}
+}
@@ -1,8 +1,6 @@
 package caddy_esbuild_plugin
 
 import (
-	"crypto/sha1"
-	"encoding/hex"
 	"encoding/json"
 	"go.uber.org/zap"
 	"net/http"
@@ -36,17 +34,15 @@ type Input struct {
 }
 
 func (m *Esbuild) handleManifest(w http.ResponseWriter, r *http.Request) error {
-
-	if m.esbuild == nil {
+	b := m.snapshot()
+	if b.result == nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(200)
 		_, _ = w.Write([]byte("{}"))
 		return nil
 	}
 
-	sha := sha1.New()
-	sha.Write([]byte(m.esbuild.Metafile))
-	etag := hex.EncodeToString(sha.Sum(nil))
+	etag := hashContents([]byte(b.result.Metafile))
 	cachedETag := r.Header.Get("If-None-Match")
 	if cachedETag == etag {
 		w.WriteHeader(304) //No change
@@ -57,7 +53,7 @@ func (m *Esbuild) handleManifest(w http.ResponseWriter, r *http.Request) error {
 
 	manifest := make(map[string]string)
 
-	for target, output := range m.metafile.Outputs {
+	for target, output := range b.metafile.Outputs {
 		source := output.EntryPoint
 		target, _ := filepath.Abs(target)
 		m.logger.Debug("Source", zap.String("source", source), zap.String("target", target))
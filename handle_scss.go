@@ -64,7 +64,7 @@ func (m *Esbuild) createSassPlugin() *api.Plugin {
 						return api.OnLoadResult{}, fmt.Errorf("sass: unable to compile: %s", err)
 					}
 					files := comp.Imports()
-					go m.watchFiles(files)
+					m.watchFiles(files)
 
 					contents := contentBuffer.String()
 
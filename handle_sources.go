@@ -0,0 +1,94 @@
+package caddy_esbuild_plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/evanw/esbuild/pkg/api"
+	"go.uber.org/zap"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func (m *Esbuild) isSourceRoute(file string) bool {
+	return m.ServeSources != "" && strings.HasPrefix(file, m.ServeSources+"/")
+}
+
+// handleSource serves an original source file, but only when the current build used it as input.
+func (m *Esbuild) handleSource(w http.ResponseWriter, r *http.Request, file string, h caddyhttp.Handler) error {
+	source := strings.TrimPrefix(file, m.ServeSources+"/")
+	metafile := m.snapshot().metafile
+	if metafile == nil {
+		return h.ServeHTTP(w, r)
+	}
+	if _, ok := metafile.Inputs[source]; !ok {
+		return h.ServeHTTP(w, r)
+	}
+
+	content, err := os.ReadFile(filepath.FromSlash(source))
+	if err != nil {
+		return h.ServeHTTP(w, r)
+	}
+
+	etag := hashContents(content)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(304) //No change
+		return nil
+	}
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(200)
+	_, _ = w.Write(content)
+	m.logger.Debug(fmt.Sprintf("esbuild served source %s", r.RequestURI), zap.String("source", source))
+	return nil
+}
+
+// rewriteSourceMaps points the sources of every linked source map at the
+// serve_sources prefix, using the same paths as the metafile inputs.
+func (m *Esbuild) rewriteSourceMaps(result *api.BuildResult) {
+	var metafile = Metafile{}
+	if err := json.Unmarshal([]byte(result.Metafile), &metafile); err != nil {
+		return
+	}
+	cwd, _ := os.Getwd()
+
+	for i, f := range result.OutputFiles {
+		if filepath.Ext(f.Path) != ".map" {
+			continue
+		}
+
+		var sourcemap map[string]json.RawMessage
+		var sources []string
+		if err := json.Unmarshal(f.Contents, &sourcemap); err != nil {
+			continue
+		}
+		if err := json.Unmarshal(sourcemap["sources"], &sources); err != nil {
+			continue
+		}
+
+		for j, source := range sources {
+			abs := filepath.Join(filepath.Dir(f.Path), filepath.FromSlash(source))
+			rel, err := filepath.Rel(cwd, abs)
+			if err != nil {
+				continue
+			}
+			rel = filepath.ToSlash(rel)
+			if _, ok := metafile.Inputs[rel]; ok {
+				sources[j] = m.ServeSources + "/" + rel
+			}
+		}
+
+		sourcemap["sources"], _ = json.Marshal(sources)
+		contents, err := json.Marshal(sourcemap)
+		if err != nil {
+			m.logger.Warn("Failed to rewrite source map", zap.Error(err), zap.String("file", f.Path))
+			continue
+		}
+		result.OutputFiles[i].Contents = contents
+	}
+}
@@ -0,0 +1,97 @@
+package caddy_esbuild_plugin
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"go.uber.org/zap"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func (m *Esbuild) isSpaRoute(file string) bool {
+	if m.SpaFallback == "" {
+		return false
+	}
+	prefix := strings.TrimSuffix(m.SpaFallback, "/")
+	if file != prefix && !strings.HasPrefix(file, prefix+"/") {
+		return false
+	}
+
+	// Anything with an extension is an asset, and a 404 is the right answer
+	return filepath.Ext(file) == ""
+}
+
+func (m *Esbuild) serveSpaFallback(w http.ResponseWriter, r *http.Request, h caddyhttp.Handler) error {
+	buf := new(bytes.Buffer)
+	rec := caddyhttp.NewResponseRecorder(w, buf, func(status int, header http.Header) bool {
+		return status == http.StatusNotFound
+	})
+
+	err := h.ServeHTTP(rec, r)
+	var handlerErr caddyhttp.HandlerError
+	if errors.As(err, &handlerErr) && handlerErr.StatusCode == http.StatusNotFound {
+		return m.handleSpaIndex(w, r)
+	}
+	if err != nil {
+		return err
+	}
+
+	if rec.Buffered() && rec.Status() == http.StatusNotFound {
+		return m.handleSpaIndex(w, r)
+	}
+
+	return rec.WriteResponse()
+}
+
+func (m *Esbuild) handleSpaIndex(w http.ResponseWriter, r *http.Request) error {
+	var content []byte
+	if m.SpaTemplate != "" {
+		template, err := os.ReadFile(m.SpaTemplate)
+		if err != nil {
+			m.logger.Error("Failed to read spa template", zap.Error(err), zap.String("template", m.SpaTemplate))
+			return caddyhttp.Error(http.StatusInternalServerError, err)
+		}
+		content = template
+	} else {
+		content = m.generateIndex()
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(200)
+	_, _ = w.Write(content)
+	m.logger.Debug(fmt.Sprintf("esbuild served spa fallback for %s", r.RequestURI))
+	return nil
+}
+
+func (m *Esbuild) generateIndex() []byte {
+	var styles, scripts strings.Builder
+	for _, entry := range m.snapshot().entries {
+		if entry.CSS != "" {
+			styles.WriteString(fmt.Sprintf("    <link rel=\"stylesheet\" href=\"%s\">\n", entry.CSS))
+		}
+		if entry.JS != "" {
+			scripts.WriteString(fmt.Sprintf("    <script src=\"%s\"></script>\n", entry.JS))
+		}
+	}
+	if m.LiveReload {
+		scripts.WriteString(fmt.Sprintf("    <script src=\"%s/__livereload.js\"></script>\n", m.outdir()))
+	}
+
+	index := `<!DOCTYPE html>
+<html>
+  <head>
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+%s  </head>
+  <body>
+    <div id="root"></div>
+%s  </body>
+</html>
+`
+	return []byte(fmt.Sprintf(index, styles.String(), scripts.String()))
+}
@@ -0,0 +1,402 @@
+package caddy_esbuild_plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/evanw/esbuild/pkg/api"
+	"go.uber.org/zap"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var transformExtensions = []string{".tsx", ".ts", ".jsx", ".js", ".mjs"}
+
+// importPattern matches the module specifiers esbuild prints for static imports,
+// re-exports and dynamic imports, which are always double quoted.
+var importPattern = regexp.MustCompile(`(\bfrom\s*|\bimport\s*\(\s*|(?m:^)\s*import\s*)"([^"]+)"`)
+
+// dependencies are the bare imports used by the transformed sources,
+// pre-bundled as one esm build so they share a single copy of every package.
+type dependencies struct {
+	sync.Mutex
+	scanned    bool
+	stale      bool
+	specifiers map[string]bool
+	outputs    map[string]api.OutputFile
+	hashes     map[string]string
+
+	definesHash string
+}
+
+func (m *Esbuild) transformRoot() string {
+	if m.TransformRoot == "" {
+		return "."
+	}
+	return m.TransformRoot
+}
+
+// isTransformRoute checks the cleaned path, as that is the file transformPath reads.
+func (m *Esbuild) isTransformRoute(file string) bool {
+	return m.Transform != "" && strings.HasPrefix(path.Clean("/"+file), m.Transform+"/")
+}
+
+func (m *Esbuild) isDependencyRoute(file string) bool {
+	return m.Transform != "" && strings.HasPrefix(file, m.outdir()+"/__deps/")
+}
+
+func (m *Esbuild) handleTransform(w http.ResponseWriter, r *http.Request, file string, h caddyhttp.Handler) error {
+	ext := filepath.Ext(file)
+	if ext == ".css" {
+		if _, ok := r.URL.Query()["import"]; ok {
+			return m.handleCssModule(w, r, file, h)
+		}
+		return h.ServeHTTP(w, r)
+	}
+	// Images, fonts and anything else under the prefix are left to the next handler
+	if ext != "" && !isTransformExtension(ext) {
+		return h.ServeHTTP(w, r)
+	}
+
+	filename, ok := resolveModuleFile(m.transformPath(file))
+	if !ok || !isTransformExtension(filepath.Ext(filename)) {
+		return h.ServeHTTP(w, r)
+	}
+
+	source, err := os.ReadFile(filename)
+	if err != nil {
+		return h.ServeHTTP(w, r)
+	}
+
+	// The defines change with the env files, without the source changing
+	b := m.snapshot()
+	etag := hashContents(append(source, b.definesHash...))
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(304) //No change
+		return nil
+	}
+
+	result := api.Transform(string(source), api.TransformOptions{
+		Banner:     m.hotContextPrelude(),
+		Loader:     m.transformLoader(filepath.Ext(filename)),
+		Format:     api.FormatESModule,
+		Sourcemap:  api.SourceMapInline,
+		Sourcefile: file,
+		JSXMode:    api.JSXModeTransform,
+		Define:     b.defines,
+	})
+	if len(result.Errors) > 0 {
+		for _, err := range result.Errors {
+			m.logger.Error(err.Text, zap.String("file", filename))
+		}
+		return caddyhttp.Error(http.StatusInternalServerError, fmt.Errorf("transform failed: %s", result.Errors[0].Text))
+	}
+
+	code := m.rewriteImports(result.Code, filepath.Dir(filename))
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Content-Type", guessContentType(".js"))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(200)
+	_, _ = w.Write(code)
+	m.logger.Debug(fmt.Sprintf("esbuild transformed %s", r.RequestURI), zap.String("source", filename))
+	return nil
+}
+
+func (m *Esbuild) handleCssModule(w http.ResponseWriter, r *http.Request, file string, h caddyhttp.Handler) error {
+	source, err := os.ReadFile(m.transformPath(file))
+	if err != nil {
+		return h.ServeHTTP(w, r)
+	}
+
+	etag := hashContents(source)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(304) //No change
+		return nil
+	}
+
+	css, _ := json.Marshal(string(source))
+	id, _ := json.Marshal(file)
+	module := m.hotContextPrelude() + "\n" +
+		"import.meta.hot.accept();\n" +
+		"const id = %s;\n" +
+		"let style = document.querySelector(`style[data-esbuild=\"${id}\"]`);\n" +
+		"if (!style) { style = document.createElement('style'); style.dataset.esbuild = id; document.head.appendChild(style); }\n" +
+		"style.textContent = %s;\n"
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Content-Type", guessContentType(".js"))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(200)
+	_, _ = w.Write([]byte(fmt.Sprintf(module, id, css)))
+	return nil
+}
+
+// hotContextPrelude gives every transformed module its import.meta.hot
+func (m *Esbuild) hotContextPrelude() string {
+	return fmt.Sprintf("import { createHotContext as __createHotContext } from %q; import.meta.hot = __createHotContext(import.meta.url);", m.outdir()+"/__hmr.js")
+}
+
+// handleHmrClient serves the module behind import.meta.hot. The runtime itself is part of the live
+// reload client, so it is shared with bundles that include the client. Without live reload
+// nothing is ever updated, and import.meta.hot does nothing.
+func (m *Esbuild) handleHmrClient(w http.ResponseWriter, r *http.Request) error {
+	w.Header().Set("Content-Type", guessContentType(".js"))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(200)
+	if !m.LiveReload {
+		_, _ = w.Write([]byte("export const createHotContext = url => ({ url: new URL(url, location.href), data: {}, accept() {}, dispose() {}, invalidate() { location.reload(); } });\n"))
+		return nil
+	}
+	_, _ = w.Write([]byte(m.liveReloadClient()))
+	_, _ = w.Write([]byte("export const createHotContext = url => window.__esbuildHmr.createHotContext(url);\n"))
+	return nil
+}
+
+// transformPath maps a request path onto the filesystem below the transform root.
+func (m *Esbuild) transformPath(file string) string {
+	return filepath.Join(m.transformRoot(), filepath.FromSlash(path.Clean("/"+file)))
+}
+
+// transformURL is the inverse of transformPath.
+func (m *Esbuild) transformURL(filename string) (string, bool) {
+	root, _ := filepath.Abs(m.transformRoot())
+	filename, _ = filepath.Abs(filename)
+	rel, err := filepath.Rel(root, filename)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return "", false
+	}
+
+	url := "/" + filepath.ToSlash(rel)
+	if !m.isTransformRoute(url) {
+		return "", false
+	}
+	return url, true
+}
+
+func (m *Esbuild) transformLoader(ext string) api.Loader {
+	if l, ok := m.Loader[ext]; ok {
+		if loader, err := ParseLoader(l); err == nil {
+			return loader
+		}
+	}
+
+	switch ext {
+	case ".ts":
+		return api.LoaderTS
+	case ".tsx":
+		return api.LoaderTSX
+	case ".jsx":
+		return api.LoaderJSX
+	default:
+		return api.LoaderJS
+	}
+}
+
+func isTransformExtension(ext string) bool {
+	for _, e := range transformExtensions {
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveModuleFile finds the file a browser import points to, trying the
+// usual extensions and directory indexes like node does.
+func resolveModuleFile(filename string) (string, bool) {
+	if stat, err := os.Stat(filename); err == nil && !stat.IsDir() {
+		return filename, true
+	}
+	for _, ext := range transformExtensions {
+		if _, err := os.Stat(filename + ext); err == nil {
+			return filename + ext, true
+		}
+	}
+	for _, ext := range transformExtensions {
+		index := filepath.Join(filename, "index"+ext)
+		if _, err := os.Stat(index); err == nil {
+			return index, true
+		}
+	}
+	return "", false
+}
+
+func (m *Esbuild) rewriteImports(code []byte, dir string) []byte {
+	return importPattern.ReplaceAllFunc(code, func(match []byte) []byte {
+		groups := importPattern.FindSubmatch(match)
+		specifier := string(groups[2])
+		rewritten := m.rewriteSpecifier(specifier, dir)
+		if rewritten == specifier {
+			return match
+		}
+		return []byte(string(groups[1]) + "\"" + rewritten + "\"")
+	})
+}
+
+func (m *Esbuild) rewriteSpecifier(specifier string, dir string) string {
+	if strings.HasPrefix(specifier, "/") || strings.Contains(specifier, "://") {
+		return specifier
+	}
+
+	if strings.HasPrefix(specifier, ".") {
+		filename := filepath.Join(dir, filepath.FromSlash(specifier))
+		if filepath.Ext(filename) == ".css" {
+			if url, ok := m.transformURL(filename); ok {
+				return url + "?import"
+			}
+			return specifier
+		}
+
+		resolved, ok := resolveModuleFile(filename)
+		if !ok {
+			return specifier
+		}
+		if url, ok := m.transformURL(resolved); ok {
+			return url
+		}
+		return specifier
+	}
+
+	if filepath.Ext(specifier) == ".css" {
+		return specifier
+	}
+
+	m.addDependency(specifier)
+	return m.outdir() + "/__deps/" + specifier + ".js"
+}
+
+func (m *Esbuild) addDependency(specifier string) {
+	m.deps.Lock()
+	defer m.deps.Unlock()
+
+	if !m.deps.specifiers[specifier] {
+		m.deps.specifiers[specifier] = true
+		m.deps.stale = true
+	}
+}
+
+func (m *Esbuild) handleDependency(w http.ResponseWriter, r *http.Request, file string, h caddyhttp.Handler) error {
+	b := m.snapshot()
+	m.deps.Lock()
+	if !m.deps.scanned {
+		m.scanDependencies()
+	}
+	if m.deps.stale || m.deps.definesHash != b.definesHash {
+		m.buildDependencies(b)
+	}
+	f, ok := m.deps.outputs[file]
+	etag := m.deps.hashes[file]
+	m.deps.Unlock()
+
+	if !ok {
+		return h.ServeHTTP(w, r)
+	}
+
+	cachedETag := r.Header.Get("If-None-Match")
+	if cachedETag == etag {
+		w.WriteHeader(304) //No change
+		return nil
+	}
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Content-Type", guessContentType(f.Path))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(200)
+	_, _ = w.Write(f.Contents)
+	m.logger.Debug(fmt.Sprintf("esbuild handled dependency %s", r.RequestURI), zap.String("source", f.Path))
+	return nil
+}
+
+// scanDependencies collects every bare import reachable from the sources up front,
+// so the first dependency build already contains all of them. Must hold m.deps.
+func (m *Esbuild) scanDependencies() {
+	var lock sync.Mutex
+	found := make(map[string]bool)
+
+	loader := map[string]api.Loader{}
+	for ext, l := range m.Loader {
+		parseLoader, _ := ParseLoader(l)
+		loader[ext] = parseLoader
+	}
+
+	api.Build(api.BuildOptions{
+		EntryPointsAdvanced: m.Sources,
+		NodePaths:           m.NodePaths,
+		Outdir:              m.outdir(),
+		Write:               false,
+		Bundle:              true,
+		Loader:              loader,
+		Plugins: []api.Plugin{{
+			Name: "scanDependencies",
+			Setup: func(build api.PluginBuild) {
+				build.OnResolve(api.OnResolveOptions{Filter: `^[^./]`},
+					func(args api.OnResolveArgs) (api.OnResolveResult, error) {
+						if args.Kind == api.ResolveEntryPoint {
+							return api.OnResolveResult{}, nil
+						}
+						lock.Lock()
+						found[args.Path] = true
+						lock.Unlock()
+						return api.OnResolveResult{Path: args.Path, External: true}, nil
+					})
+			},
+		}},
+	})
+
+	for specifier := range found {
+		if filepath.Ext(specifier) != ".css" {
+			m.deps.specifiers[specifier] = true
+		}
+	}
+	m.deps.scanned = true
+	m.deps.stale = true
+}
+
+// buildDependencies bundles all known dependencies with code splitting, using the defines of the build. Must hold m.deps.
+func (m *Esbuild) buildDependencies(b *buildSnapshot) {
+	var specifiers []string
+	for specifier := range m.deps.specifiers {
+		specifiers = append(specifiers, specifier)
+	}
+	sort.Strings(specifiers)
+
+	var entries []api.EntryPoint
+	for _, specifier := range specifiers {
+		entries = append(entries, api.EntryPoint{InputPath: specifier, OutputPath: specifier})
+	}
+
+	result := api.Build(api.BuildOptions{
+		EntryPointsAdvanced: entries,
+		NodePaths:           m.NodePaths,
+		Outdir:              m.outdir() + "/__deps",
+		Define:              b.defines,
+		Format:              api.FormatESModule,
+		Splitting:           true,
+		Bundle:              true,
+		Write:               false,
+	})
+	for _, err := range result.Errors {
+		m.logger.Error(err.Text)
+	}
+
+	m.deps.outputs = make(map[string]api.OutputFile)
+	m.deps.hashes = make(map[string]string)
+	for _, f := range result.OutputFiles {
+		m.deps.outputs[f.Path] = f
+		m.deps.hashes[f.Path] = hashContents(f.Contents)
+	}
+	m.deps.stale = false
+	m.deps.definesHash = b.definesHash
+	m.logger.Info("Pre-bundled dependencies", zap.Strings("dependencies", specifiers))
+}
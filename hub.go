@@ -0,0 +1,170 @@
+package caddy_esbuild_plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// buildEvent is a message of the live reload protocol. Type is one of "build-start",
+// "build-ok", "build-error", "ping", or "reload" when a watched file outside the
+// build changed, listed in Changed. A successful build tells the client what to do
+// with Action: "reload", "css" to swap the stylesheets in CSS, "hmr" to hot update
+// Modules, or "none". Entries are the sources whose outputs changed.
+type buildEvent struct {
+	ID       int64       `json:"id,omitempty"`
+	Type     string      `json:"type"`
+	Action   string      `json:"action,omitempty"`
+	Changed  []string    `json:"changed,omitempty"`
+	CSS      []cssChange `json:"css,omitempty"`
+	Modules  []string    `json:"modules,omitempty"`
+	Entries  []string    `json:"entries,omitempty"`
+	Warnings []string    `json:"warnings,omitempty"`
+	Errors   []string    `json:"errors,omitempty"`
+	Duration int64       `json:"duration,omitempty"`
+}
+
+// cssChange tells the client which stylesheet to swap for which.
+// From and To only differ when file_hash is enabled.
+type cssChange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// writeSSE writes the event as server-sent event. Only finished builds carry an id,
+// so Last-Event-ID always is the last build result the client has seen.
+func (event buildEvent) writeSSE(w io.Writer) {
+	payload, _ := json.Marshal(event)
+	if event.Type == "build-ok" || event.Type == "build-error" {
+		_, _ = fmt.Fprintf(w, "id: %d\n", event.ID)
+	}
+	_, _ = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, payload)
+}
+
+// subscription holds the entries a connected page uses, so it only receives
+// the builds changing them. A page that did not announce any receives all builds.
+type subscription struct {
+	entries map[string]bool
+}
+
+func (s *subscription) wants(event buildEvent) bool {
+	if event.Type != "build-ok" || len(s.entries) == 0 || len(event.Entries) == 0 {
+		return true
+	}
+	for _, entry := range event.Entries {
+		if s.entries[entry] {
+			return true
+		}
+	}
+	return false
+}
+
+// liveReloadHub fans build events out to the connected live reload clients.
+type liveReloadHub struct {
+	lock    sync.Mutex
+	clients map[chan buildEvent]*subscription
+	closed  bool
+	lastID  int64
+	last    *buildEvent
+}
+
+// newLiveReloadHub starts the build ids at the current time, so they keep increasing
+// across restarts and a client reconnecting to a restarted Caddy gets the last build replayed.
+func newLiveReloadHub() *liveReloadHub {
+	return &liveReloadHub{
+		clients: make(map[chan buildEvent]*subscription),
+		lastID:  time.Now().UnixNano() / int64(time.Millisecond),
+	}
+}
+
+// subscribe returns a channel receiving all future events for the entries, and the number of connected clients.
+// A client that has not seen the last build result, according to lastEventID, receives it first.
+// The channel is closed when the hub shuts down.
+func (hub *liveReloadHub) subscribe(lastEventID int64, entries map[string]bool) (chan buildEvent, int) {
+	hub.lock.Lock()
+	defer hub.lock.Unlock()
+
+	events := make(chan buildEvent, 16)
+	if hub.closed {
+		close(events)
+		return events, len(hub.clients)
+	}
+
+	client := &subscription{entries: entries}
+	if lastEventID > 0 && hub.last != nil && hub.last.ID > lastEventID && client.wants(*hub.last) {
+		events <- *hub.last
+	}
+	hub.clients[events] = client
+	return events, len(hub.clients)
+}
+
+// filter replaces the entries a client announced when it subscribed.
+func (hub *liveReloadHub) filter(events chan buildEvent, entries map[string]bool) {
+	hub.lock.Lock()
+	defer hub.lock.Unlock()
+
+	if client, ok := hub.clients[events]; ok {
+		client.entries = entries
+	}
+}
+
+func (hub *liveReloadHub) unsubscribe(events chan buildEvent) int {
+	hub.lock.Lock()
+	defer hub.lock.Unlock()
+
+	if _, ok := hub.clients[events]; ok {
+		delete(hub.clients, events)
+		close(events)
+	}
+	return len(hub.clients)
+}
+
+func (hub *liveReloadHub) count() int {
+	hub.lock.Lock()
+	defer hub.lock.Unlock()
+	return len(hub.clients)
+}
+
+// startBuild announces a new build and returns its id.
+func (hub *liveReloadHub) startBuild() int64 {
+	hub.lock.Lock()
+	hub.lastID++
+	id := hub.lastID
+	hub.lock.Unlock()
+
+	hub.publish(buildEvent{ID: id, Type: "build-start"})
+	return id
+}
+
+func (hub *liveReloadHub) publish(event buildEvent) {
+	hub.lock.Lock()
+	defer hub.lock.Unlock()
+
+	if event.Type == "build-ok" || event.Type == "build-error" {
+		hub.last = &event
+	}
+
+	for events, client := range hub.clients {
+		if !client.wants(event) {
+			continue
+		}
+		select {
+		case events <- event:
+		default:
+			// The client is not keeping up, it will still see the events already queued
+		}
+	}
+}
+
+func (hub *liveReloadHub) close() {
+	hub.lock.Lock()
+	defer hub.lock.Unlock()
+
+	for events := range hub.clients {
+		delete(hub.clients, events)
+		close(events)
+	}
+	hub.closed = true
+}
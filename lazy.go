@@ -0,0 +1,60 @@
+package caddy_esbuild_plugin
+
+import (
+	"path"
+	"strings"
+	"sync"
+)
+
+// firstBuild runs the first build and starts the watchers exactly once, so
+// concurrent first requests of a lazy handler all wait on the same build.
+type firstBuild struct {
+	once sync.Once
+	err  error
+}
+
+func (m *Esbuild) build() error {
+	m.firstBuild.once.Do(func() {
+		m.firstBuild.err = m.start()
+	})
+	return m.firstBuild.err
+}
+
+func (m *Esbuild) start() error {
+	if err := m.builds.wait(m.builds.request(true)); err != nil {
+		return err
+	}
+	if m.watchMode() == "off" {
+		return nil
+	}
+
+	if m.Env {
+		m.watchEnv()
+	}
+	if m.pollMode() {
+		m.pollFiles()
+	} else if len(m.Watch) > 0 {
+		m.watchGlobs()
+	}
+	return nil
+}
+
+// needsBuild tells whether a request could be answered from the build, and
+// so has to wait for the first build of a lazy handler.
+func (m *Esbuild) needsBuild(file string) bool {
+	outdir := m.outdir()
+	if file == outdir || strings.HasPrefix(file, outdir+"/") {
+		return true
+	}
+	if m.InjectHTML || m.isSpaRoute(file) || m.isTransformRoute(file) || m.isSourceRoute(file) {
+		return true
+	}
+	if m.Target == "" {
+		for _, s := range m.Sources {
+			if file == path.Clean("/"+s.InputPath) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -7,12 +7,14 @@ import (
 	"github.com/evanw/esbuild/pkg/api"
 	"go.uber.org/zap"
 	"net/http"
-	"path/filepath"
+	"regexp"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
 type Esbuild struct {
+	ID         string            `json:"id,omitempty"`
 	Target     string            `json:"target,omitempty"`
 	LiveReload bool              `json:"auto_reload,omitempty"`
 	Scss       bool              `json:"scss,omitempty"`
@@ -22,17 +24,54 @@ type Esbuild struct {
 	Defines    map[string]string `json:"defines,omitempty"`
 	Sources    []api.EntryPoint  `json:"source,omitempty"`
 	NodePaths  []string          `json:"n_ode_paths,omitempty"`
+	Watch      []string          `json:"watch,omitempty"`
+	Debounce   caddy.Duration    `json:"debounce,omitempty"`
 
-	logger       *zap.Logger
-	esbuild      *api.BuildResult
-	hashes       map[string]string
-	globalQuit   chan struct{}
-	lastDuration *time.Duration
-	metafile     *Metafile
+	Lazy         bool           `json:"lazy,omitempty"`
+	Mode         string         `json:"mode,omitempty"`
+	WatchMode    string         `json:"watch_mode,omitempty"`
+	PollInterval caddy.Duration `json:"poll_interval,omitempty"`
+
+	LiveReloadTransport string `json:"live_reload_transport,omitempty"`
+	LiveReloadInject    string `json:"live_reload_inject,omitempty"`
+	LogClientErrors     bool   `json:"log_client_errors,omitempty"`
+
+	SpaFallback string `json:"spa_fallback,omitempty"`
+	SpaTemplate string `json:"spa_template,omitempty"`
+
+	InjectHTML    bool     `json:"inject_html,omitempty"`
+	InjectEntries []string `json:"inject_entries,omitempty"`
+
+	Transform     string `json:"transform,omitempty"`
+	TransformRoot string `json:"transform_root,omitempty"`
+
+	ServeSources string `json:"serve_sources,omitempty"`
+
+	logger     *zap.Logger
+	current    *atomic.Value
+	globalQuit chan struct{}
+	generation int64
+	firstBuild *firstBuild
+	watcher    *fileWatcher
+	builds     *scheduler
+	deps       *dependencies
+	hub        *liveReloadHub
+
+	watchPatterns   []*regexp.Regexp
+	rebuildDebounce *debouncer
+	envDebounce     *debouncer
+	eventDebounce   *eventBuffer
 }
 
 func (m *Esbuild) Cleanup() error {
+	m.unregister()
+	m.builds.close()
 	close(m.globalQuit)
+	m.watcher.close()
+	m.rebuildDebounce.stop()
+	m.envDebounce.stop()
+	m.eventDebounce.stop()
+	m.hub.close()
 	return nil
 }
 
@@ -50,10 +89,31 @@ func (Esbuild) CaddyModule() caddy.ModuleInfo {
 
 func (m *Esbuild) Provision(ctx caddy.Context) error {
 	m.logger = ctx.Logger(m)
-	m.hashes = make(map[string]string)
+	m.current = &atomic.Value{}
 	m.globalQuit = make(chan struct{})
-	m.Defines = make(map[string]string)
-	m.initEsbuild()
+	m.hub = newLiveReloadHub()
+	m.rebuildDebounce = &debouncer{window: time.Duration(m.Debounce)}
+	m.envDebounce = &debouncer{window: time.Duration(m.Debounce)}
+	m.eventDebounce = &eventBuffer{debouncer: debouncer{window: time.Duration(m.Debounce)}}
+	m.deps = &dependencies{specifiers: make(map[string]bool)}
+	m.watcher = newFileWatcher(m.logger, m.watchMode() == "notify")
+	m.builds = newScheduler(m.runBuild)
+	m.firstBuild = &firstBuild{}
+
+	// Cleanup runs when provisioning fails, everything above must be set by then
+	patterns, err := compileGlobs(m.Watch)
+	if err != nil {
+		return err
+	}
+	m.watchPatterns = patterns
+	if err := m.register(ctx); err != nil {
+		return err
+	}
+	if !m.Lazy {
+		if err := m.build(); err != nil {
+			return err
+		}
+	}
 
 	var sources []string
 	for _, s := range m.Sources {
@@ -65,13 +125,27 @@ func (m *Esbuild) Provision(ctx caddy.Context) error {
 	}
 
 	m.logger.Info("Initialized esbuild",
+		zap.String("id", m.handlerID()),
 		zap.String("target", m.Target),
 		zap.Strings("sources", sources),
 		zap.Strings("loaders", loaders),
 		zap.Bool("sass", m.Scss),
 		zap.Bool("env", m.Env),
 		zap.Bool("live_reload", m.LiveReload),
-		zap.Strings("node_path", m.NodePaths))
+		zap.String("live_reload_transport", m.LiveReloadTransport),
+		zap.String("live_reload_inject", m.liveReloadInject()),
+		zap.Bool("log_client_errors", m.LogClientErrors),
+		zap.String("spa_fallback", m.SpaFallback),
+		zap.Bool("inject_html", m.InjectHTML),
+		zap.String("transform", m.Transform),
+		zap.String("serve_sources", m.ServeSources),
+		zap.Strings("node_path", m.NodePaths),
+		zap.Strings("watch", m.Watch),
+		zap.Bool("lazy", m.Lazy),
+		zap.String("mode", m.Mode),
+		zap.String("watch_mode", m.watchMode()),
+		zap.Duration("poll_interval", m.pollInterval()),
+		zap.Duration("debounce", time.Duration(m.Debounce)))
 	return nil
 }
 
@@ -81,6 +155,27 @@ func (m *Esbuild) Validate() error {
 		return fmt.Errorf("no source file")
 	}
 
+	switch m.LiveReloadTransport {
+	case "", "sse", "websocket":
+	default:
+		return fmt.Errorf("invalid live reload transport: %q", m.LiveReloadTransport)
+	}
+	switch m.Mode {
+	case "", "development", "production":
+	default:
+		return fmt.Errorf("invalid mode: %q", m.Mode)
+	}
+	switch m.WatchMode {
+	case "", "notify", "poll", "off":
+	default:
+		return fmt.Errorf("invalid watch mode: %q", m.WatchMode)
+	}
+	switch m.LiveReloadInject {
+	case "", "bundle", "script":
+	default:
+		return fmt.Errorf("invalid live reload inject mode: %q", m.LiveReloadInject)
+	}
+
 	for _, l := range m.Loader {
 		_, err := ParseLoader(l)
 		if err != nil {
@@ -92,60 +187,91 @@ func (m *Esbuild) Validate() error {
 }
 
 func (m *Esbuild) ServeHTTP(w http.ResponseWriter, r *http.Request, h caddyhttp.Handler) error {
-	if r.Method != "GET" {
-		return h.ServeHTTP(w, r)
+	outdir := m.outdir()
+
+	file := r.RequestURI
+	if index := strings.Index(file, "?"); index > 1 {
+		file = file[:index]
 	}
 
-	outdir := m.Target
-	if outdir == "" {
-		outdir = "/_build"
+	if m.Lazy && m.needsBuild(file) {
+		if err := m.build(); err != nil {
+			return caddyhttp.Error(http.StatusInternalServerError, err)
+		}
 	}
+	m.setPlaceholders(r)
 
-	file := r.RequestURI
-	if index := strings.Index(file, "?"); index > 1 {
-		file = file[:index-1]
+	if r.Method == "POST" && m.LogClientErrors && file == outdir+"/__log" {
+		return m.handleClientLog(w, r)
+	}
+	if r.Method != "GET" {
+		return h.ServeHTTP(w, r)
 	}
 
 	if file == outdir+"/__livereload" {
 		_ = m.handleLiveReload(w, r)
 		return nil
 	}
+	if file == outdir+"/__livereload.js" {
+		return m.handleLiveReloadClient(w, r)
+	}
+	if file == outdir+"/__livereload_ws" {
+		return m.handleLiveReloadSocket(w, r)
+	}
 	if file == outdir+"/manifest.json" {
 		_ = m.handleManifest(w, r)
 		return nil
 	}
 
-	if m.esbuild != nil {
-		for _, f := range m.esbuild.OutputFiles {
-			if file == f.Path {
-				return m.handleAsset(w, r, f)
-			}
-		}
+	b := m.snapshot()
+	if f, ok := b.routes[file]; ok {
+		return m.handleAsset(w, r, b, f)
+	}
 
-		if m.Target == "" {
-			for target, output := range m.metafile.Outputs {
-				entrypoint := output.EntryPoint
-				if !strings.HasPrefix(entrypoint, "/") {
-					entrypoint = "/" + entrypoint
-				}
-				target, _ = filepath.Abs(target)
-				m.logger.Debug("Handling output files",
-					zap.String("file", file),
-					zap.String("entrypoint", entrypoint),
-					zap.String("target", target))
-
-				if file == entrypoint && file != "/" {
-					for _, f := range m.esbuild.OutputFiles {
-						if target == f.Path {
-							return m.handleAsset(w, r, f)
-						}
-					}
-				}
-			}
-		}
+	if m.Transform != "" && file == outdir+"/__hmr.js" {
+		_ = m.handleHmrClient(w, r)
+		return nil
+	}
+	if m.isDependencyRoute(file) {
+		return m.handleDependency(w, r, file, h)
 	}
+	if m.isTransformRoute(file) {
+		return m.handleTransform(w, r, file, h)
+	}
+	if m.isSourceRoute(file) {
+		return m.handleSource(w, r, file, h)
+	}
+
+	next := h
+	if m.isSpaRoute(file) {
+		next = caddyhttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+			return m.serveSpaFallback(w, r, h)
+		})
+	}
+	if m.InjectHTML {
+		return m.serveInjected(w, r, next)
+	}
+
+	return next.ServeHTTP(w, r)
+}
+
+// watchMode is off in production, nothing changes after the first build.
+func (m *Esbuild) watchMode() string {
+	if m.Mode == "production" {
+		return "off"
+	}
+	if m.WatchMode == "" {
+		return "notify"
+	}
+	return m.WatchMode
+}
 
-	return h.ServeHTTP(w, r)
+// outdir is the public path every build output is served from.
+func (m *Esbuild) outdir() string {
+	if m.Target == "" {
+		return "/_build"
+	}
+	return m.Target
 }
 
 // Interface guards
@@ -0,0 +1,79 @@
+package caddy_esbuild_plugin
+
+import (
+	"github.com/evanw/esbuild/pkg/api"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// entryOutput holds the public paths built for one configured source.
+type entryOutput struct {
+	Name string
+	JS   string
+	CSS  string
+}
+
+// entryOutputs maps every entrypoint in the metafile back to the
+// source alias it was configured with, together with its built js and css.
+func entryOutputs(sources []api.EntryPoint, metafile *Metafile) []entryOutput {
+	names := make(map[string]string)
+	for _, s := range sources {
+		names[filepath.Clean(s.InputPath)] = s.OutputPath
+	}
+
+	// With file_hash the css gets a hash of its own, so match without the hash
+	stylesheets := make(map[string]string)
+	for target := range metafile.Outputs {
+		target, _ = filepath.Abs(target)
+		if filepath.Ext(target) == ".css" {
+			stylesheets[outputKey(target)] = target
+		}
+	}
+
+	var entries []entryOutput
+	for target, output := range metafile.Outputs {
+		if output.EntryPoint == "" {
+			continue
+		}
+
+		name, ok := names[filepath.Clean(output.EntryPoint)]
+		if !ok {
+			name = parseSourceName(output.EntryPoint)
+		}
+
+		target, _ = filepath.Abs(target)
+		entry := entryOutput{Name: name}
+		if filepath.Ext(target) == ".css" {
+			entry.CSS = target
+		} else {
+			entry.JS = target
+			key := outputKey(target)
+			entry.CSS = stylesheets[strings.TrimSuffix(key, filepath.Ext(key))+".css"]
+		}
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name < entries[j].Name
+	})
+	return entries
+}
+
+// entriesForOutputs returns the names of the entries that built any of the outputs,
+// which may come from an older build when file_hash is enabled.
+func (b *buildSnapshot) entriesForOutputs(outputs []string) map[string]bool {
+	entries := make(map[string]bool)
+	for _, entry := range b.entries {
+		for _, output := range outputs {
+			if output == "" {
+				continue
+			}
+			key := outputKey(output)
+			if (entry.JS != "" && outputKey(entry.JS) == key) || (entry.CSS != "" && outputKey(entry.CSS) == key) {
+				entries[entry.Name] = true
+			}
+		}
+	}
+	return entries
+}
@@ -0,0 +1,28 @@
+package caddy_esbuild_plugin
+
+import (
+	"github.com/caddyserver/caddy/v2"
+	"net/http"
+)
+
+// setPlaceholders exposes the current build outputs as {http.esbuild.<entry>.js},
+// {http.esbuild.<entry>.css} and {http.esbuild.<entry>.integrity}.
+func (m *Esbuild) setPlaceholders(r *http.Request) {
+	repl, ok := r.Context().Value(caddy.ReplacerCtxKey).(*caddy.Replacer)
+	if !ok {
+		return
+	}
+
+	b := m.snapshot()
+	for _, entry := range b.entries {
+		prefix := "http.esbuild." + entry.Name
+		repl.Set(prefix+".js", entry.JS)
+		repl.Set(prefix+".css", entry.CSS)
+
+		primary := entry.JS
+		if primary == "" {
+			primary = entry.CSS
+		}
+		repl.Set(prefix+".integrity", b.integrity[primary])
+	}
+}
@@ -2,22 +2,45 @@ package caddy_esbuild_plugin
 
 import (
 	"github.com/evanw/esbuild/pkg/api"
+	"sync/atomic"
 	"time"
 )
 
-func (m *Esbuild) createTimingPlugin() api.Plugin {
+// createTimingPlugin publishes every build, the scheduled ones as well as esbuild's own watch
+// rebuilds. It holds m.builds.building from start to end, so builds never overlap and are
+// published in the order they ran. Builds of an esbuild context replaced by a fresh build are dropped,
+// the generation only changes while no build holds the lock.
+func (m *Esbuild) createTimingPlugin(generation int64, defines map[string]string) api.Plugin {
 	return api.Plugin{
 		Name: "timingPlugin",
 		Setup: func(build api.PluginBuild) {
 			var start time.Time
+			var id int64
+			var started bool
 
 			build.OnStart(func() (api.OnStartResult, error) {
+				m.builds.building.Lock()
+				// A stopped watcher may still start a rebuild, it is neither announced nor published
+				if atomic.LoadInt64(&m.generation) != generation {
+					m.builds.building.Unlock()
+					return api.OnStartResult{}, nil
+				}
+				started = true
 				start = time.Now()
+				id = m.hub.startBuild()
 				return api.OnStartResult{}, nil
 			})
 			build.OnEnd(func(result *api.BuildResult) {
+				// Invalid options end the build without starting it
+				if started {
+					started = false
+					defer m.builds.building.Unlock()
+				}
+				if atomic.LoadInt64(&m.generation) != generation {
+					return
+				}
 				duration := time.Now().Sub(start)
-				m.lastDuration = &duration
+				m.onBuild(*result, id, &duration, defines)
 			})
 		},
 	}
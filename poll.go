@@ -0,0 +1,141 @@
+package caddy_esbuild_plugin
+
+import (
+	"fmt"
+	"github.com/evanw/esbuild/pkg/api"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+func (m *Esbuild) pollMode() bool {
+	return m.watchMode() == "poll"
+}
+
+func (m *Esbuild) pollInterval() time.Duration {
+	if m.PollInterval <= 0 {
+		return time.Second
+	}
+	return time.Duration(m.PollInterval)
+}
+
+// pollFiles replaces the fsnotify watchers on file systems without change
+// notifications, like Docker bind mounts on macOS or NFS, by comparing the
+// size and mtime of the files registered with the watcher, like the build inputs, and the watch globs.
+func (m *Esbuild) pollFiles() {
+	files := statFiles(m.watcher.list())
+	globs := pollGlobs(m.Watch, m.watchPatterns)
+
+	go func() {
+		ticker := time.NewTicker(m.pollInterval())
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				currentFiles := statFiles(m.watcher.list())
+				for _, file := range modifiedFiles(files, currentFiles) {
+					m.watcher.changed(file)
+				}
+				files = currentFiles
+
+				currentGlobs := pollGlobs(m.Watch, m.watchPatterns)
+				changed := modifiedFiles(globs, currentGlobs)
+				for path := range globs {
+					if _, ok := currentGlobs[path]; !ok {
+						changed = append(changed, path)
+					}
+				}
+				for path := range currentGlobs {
+					if _, ok := globs[path]; !ok {
+						changed = append(changed, path)
+					}
+				}
+				if len(changed) > 0 {
+					m.logger.Debug("Files changed, reloading", zap.Strings("files", changed))
+					m.publishDebounced(buildEvent{Type: "reload", Changed: union(changed, nil)})
+				}
+				globs = currentGlobs
+			case <-m.globalQuit:
+				return
+			}
+		}
+	}()
+}
+
+// pollInputs lists the files to poll for a build: every input including node_modules,
+// the entrypoints and the files with errors, so a build failing from the start still
+// notices the fix. New files are only noticed once something imports them.
+func (m *Esbuild) pollInputs(result *api.BuildResult, b *buildSnapshot) []string {
+	var files []string
+	for _, s := range m.Sources {
+		files = append(files, s.InputPath)
+	}
+	for _, err := range result.Errors {
+		if err.Location != nil && !strings.Contains(err.Location.File, ":") {
+			files = append(files, err.Location.File)
+		}
+	}
+	if b.metafile != nil {
+		for path := range b.metafile.Inputs {
+			if !strings.Contains(path, ":") {
+				files = append(files, path)
+			}
+		}
+	}
+	return files
+}
+
+func pollGlobs(globs []string, patterns []*regexp.Regexp) map[string]string {
+	var files []string
+	for _, glob := range globs {
+		_ = filepath.Walk(globBase(glob), func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return nil
+			}
+			if info.IsDir() {
+				if name := info.Name(); name == "node_modules" || name == ".git" {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			name := filepath.ToSlash(filepath.Clean(path))
+			for _, pattern := range patterns {
+				if pattern.MatchString(name) {
+					files = append(files, name)
+					break
+				}
+			}
+			return nil
+		})
+	}
+	return statFiles(files)
+}
+
+// statFiles returns size and mtime of every file, or an empty signature for missing files.
+func statFiles(files []string) map[string]string {
+	signatures := make(map[string]string)
+	for _, file := range files {
+		stat, err := os.Stat(file)
+		if err != nil {
+			signatures[file] = ""
+			continue
+		}
+		signatures[file] = fmt.Sprintf("%d-%d", stat.Size(), stat.ModTime().UnixNano())
+	}
+	return signatures
+}
+
+// modifiedFiles lists the files known before, whose signature changed.
+// Files only known now were just added to the build, and are not a change.
+func modifiedFiles(previous map[string]string, current map[string]string) []string {
+	var changed []string
+	for path, signature := range current {
+		if before, ok := previous[path]; ok && before != signature {
+			changed = append(changed, path)
+		}
+	}
+	return changed
+}
@@ -0,0 +1,127 @@
+package caddy_esbuild_plugin
+
+import (
+	"sync"
+)
+
+// scheduler runs one build at a time. Requests arriving while a build runs
+// are merged into a single pending build, which starts as soon as the running
+// one finished, so the last build always saw the latest sources.
+type scheduler struct {
+	// building is held by the timing plugin while esbuild builds, which also
+	// keeps esbuild's own watch rebuilds from overlapping the scheduled ones
+	building sync.Mutex
+
+	lock     sync.Mutex
+	finished *sync.Cond
+	run      func(fresh bool) error
+
+	running bool
+	pending bool
+	fresh   bool
+	closed  bool
+
+	started int64
+	done    int64
+	err     error
+
+	// stopWatch stops esbuild's watcher of the latest fresh build
+	stopWatch func()
+}
+
+func newScheduler(run func(fresh bool) error) *scheduler {
+	s := &scheduler{run: run}
+	s.finished = sync.NewCond(&s.lock)
+	return s
+}
+
+// request schedules a build, a fresh one throws away the incremental state.
+// It returns the build to wait for.
+func (s *scheduler) request(fresh bool) int64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return 0
+	}
+
+	s.fresh = s.fresh || fresh
+	if s.running {
+		// Supersedes whatever was pending already
+		s.pending = true
+		return s.started + 1
+	}
+
+	s.running = true
+	s.started++
+	go s.loop()
+	return s.started
+}
+
+func (s *scheduler) loop() {
+	s.lock.Lock()
+	for {
+		fresh := s.fresh
+		s.fresh = false
+		s.lock.Unlock()
+
+		err := s.run(fresh)
+
+		s.lock.Lock()
+		s.done++
+		s.err = err
+		s.finished.Broadcast()
+		if !s.pending || s.closed {
+			s.running = false
+			s.pending = false
+			s.lock.Unlock()
+			return
+		}
+		s.pending = false
+		s.started++
+	}
+}
+
+// wait blocks until the build has finished, and returns the error of the latest build.
+func (s *scheduler) wait(build int64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for s.done < build && !s.closed {
+		s.finished.Wait()
+	}
+	return s.err
+}
+
+// watching keeps the stop func of esbuild's watcher until the next fresh build,
+// or stops the watcher right away when the scheduler closed during the build.
+func (s *scheduler) watching(stop func()) {
+	s.lock.Lock()
+	if !s.closed {
+		s.stopWatch = stop
+		s.lock.Unlock()
+		return
+	}
+	s.lock.Unlock()
+	stop()
+}
+
+func (s *scheduler) stopWatching() {
+	s.lock.Lock()
+	stop := s.stopWatch
+	s.stopWatch = nil
+	s.lock.Unlock()
+
+	if stop != nil {
+		stop()
+	}
+}
+
+// close drops the pending build, stops esbuild's watcher and releases everyone waiting.
+func (s *scheduler) close() {
+	s.lock.Lock()
+	s.closed = true
+	s.pending = false
+	s.finished.Broadcast()
+	s.lock.Unlock()
+
+	s.stopWatching()
+}
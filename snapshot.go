@@ -0,0 +1,106 @@
+package caddy_esbuild_plugin
+
+import (
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/evanw/esbuild/pkg/api"
+	"go.uber.org/zap"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// buildSnapshot is everything one build produced. It is published by swapping
+// the pointer and never modified afterwards, so a request loads the current
+// snapshot once and sees a consistent build throughout, while the next build runs.
+type buildSnapshot struct {
+	result    *api.BuildResult
+	metafile  *Metafile
+	routes    map[string]api.OutputFile
+	hashes    map[string]string
+	integrity map[string]string
+	inputs    map[string]string
+	entries   []entryOutput
+	status    *buildStatus
+
+	defines     map[string]string
+	definesHash string
+}
+
+// snapshot returns the current build, which is empty until the first build finished.
+func (m *Esbuild) snapshot() *buildSnapshot {
+	if b, ok := m.current.Load().(*buildSnapshot); ok {
+		return b
+	}
+	return &buildSnapshot{}
+}
+
+// newSnapshot indexes a successful build. A failed build has no outputs, so
+// it keeps serving everything from the previous build, and only records the errors.
+func (m *Esbuild) newSnapshot(result *api.BuildResult, defines map[string]string, previous *buildSnapshot, status *buildStatus) *buildSnapshot {
+	// Encoding sorts the keys, so the same defines always hash the same
+	encoded, _ := json.Marshal(defines)
+	definesHash := hashContents(encoded)
+
+	if len(result.Errors) > 0 {
+		failed := *previous
+		failed.result = result
+		failed.status = status
+		failed.defines = defines
+		failed.definesHash = definesHash
+		return &failed
+	}
+
+	b := &buildSnapshot{
+		result:      result,
+		routes:      make(map[string]api.OutputFile),
+		hashes:      make(map[string]string),
+		integrity:   make(map[string]string),
+		status:      status,
+		defines:     defines,
+		definesHash: definesHash,
+	}
+	for _, f := range result.OutputFiles {
+		m.logger.Debug("Built file", zap.String("file", f.Path))
+		b.routes[f.Path] = f
+		b.hashes[f.Path] = hashContents(f.Contents)
+		integrity := sha512.Sum384(f.Contents)
+		b.integrity[f.Path] = "sha384-" + base64.StdEncoding.EncodeToString(integrity[:])
+	}
+
+	var metafile = Metafile{}
+	if err := json.Unmarshal([]byte(result.Metafile), &metafile); err != nil {
+		m.logger.Error("Failed to build manifest.json", zap.Error(err))
+		return b
+	}
+	b.metafile = &metafile
+	b.inputs = inputSignatures(b.metafile)
+	b.entries = entryOutputs(m.Sources, b.metafile)
+
+	// Without a target the entrypoints are also served at their source path
+	if m.Target == "" {
+		for target, output := range metafile.Outputs {
+			entrypoint := output.EntryPoint
+			if !strings.HasPrefix(entrypoint, "/") {
+				entrypoint = "/" + entrypoint
+			}
+			target, _ = filepath.Abs(target)
+			if f, ok := b.routes[target]; ok && entrypoint != "/" {
+				if _, exists := b.routes[entrypoint]; !exists {
+					b.routes[entrypoint] = f
+				}
+			}
+		}
+	}
+	return b
+}
+
+func newBuildStatus(event buildEvent) *buildStatus {
+	return &buildStatus{
+		Time:     time.Now(),
+		Duration: event.Duration,
+		Warnings: append([]string{}, event.Warnings...),
+		Errors:   append([]string{}, event.Errors...),
+	}
+}
@@ -0,0 +1,100 @@
+package caddy_esbuild_plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const vlqChars = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+
+type sourceMap struct {
+	Sources  []string `json:"sources"`
+	Mappings string   `json:"mappings"`
+	lines    [][]mappingSegment
+}
+
+// mappingSegment maps a generated column to a position in one of the sources, all zero based.
+type mappingSegment struct {
+	column       int
+	source       int
+	sourceLine   int
+	sourceColumn int
+}
+
+func parseSourceMap(contents []byte) (*sourceMap, error) {
+	var sm sourceMap
+	if err := json.Unmarshal(contents, &sm); err != nil {
+		return nil, err
+	}
+
+	var source, sourceLine, sourceColumn int
+	for _, line := range strings.Split(sm.Mappings, ";") {
+		var segments []mappingSegment
+		column := 0
+		for _, segment := range strings.Split(line, ",") {
+			if segment == "" {
+				continue
+			}
+			values, err := decodeVLQ(segment)
+			if err != nil {
+				return nil, err
+			}
+			column += values[0]
+			if len(values) < 4 {
+				continue
+			}
+			source += values[1]
+			sourceLine += values[2]
+			sourceColumn += values[3]
+			segments = append(segments, mappingSegment{column, source, sourceLine, sourceColumn})
+		}
+		sm.lines = append(sm.lines, segments)
+	}
+	return &sm, nil
+}
+
+// lookup finds the original position of a zero based generated line and column.
+func (sm *sourceMap) lookup(line int, column int) (string, int, int, bool) {
+	if line < 0 || line >= len(sm.lines) {
+		return "", 0, 0, false
+	}
+
+	var found *mappingSegment
+	for i, segment := range sm.lines[line] {
+		if segment.column > column {
+			break
+		}
+		found = &sm.lines[line][i]
+	}
+	if found == nil || found.source >= len(sm.Sources) {
+		return "", 0, 0, false
+	}
+	return sm.Sources[found.source], found.sourceLine, found.sourceColumn, true
+}
+
+func decodeVLQ(segment string) ([]int, error) {
+	var values []int
+	value, shift := 0, 0
+	for _, c := range segment {
+		digit := strings.IndexRune(vlqChars, c)
+		if digit < 0 {
+			return nil, fmt.Errorf("invalid vlq character %q", c)
+		}
+		value += (digit & 31) << shift
+		if digit&32 != 0 {
+			shift += 5
+			continue
+		}
+		if value&1 != 0 {
+			values = append(values, -(value >> 1))
+		} else {
+			values = append(values, value>>1)
+		}
+		value, shift = 0, 0
+	}
+	if shift != 0 {
+		return nil, fmt.Errorf("unterminated vlq segment %q", segment)
+	}
+	return values, nil
+}
@@ -0,0 +1,38 @@
+package caddy_esbuild_plugin
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDecodeVLQ(t *testing.T) {
+	tests := []struct {
+		segment string
+		values  []int
+	}{
+		{"AAAA", []int{0, 0, 0, 0}},
+		{"AACA", []int{0, 0, 1, 0}},
+		{"D", []int{-1}},
+		{"gB", []int{16}},
+		{"2H", []int{123}},
+		{"2HD", []int{123, -1}},
+	}
+	for _, test := range tests {
+		values, err := decodeVLQ(test.segment)
+		if err != nil {
+			t.Errorf("decodeVLQ(%q) failed: %v", test.segment, err)
+			continue
+		}
+		if !reflect.DeepEqual(values, test.values) {
+			t.Errorf("decodeVLQ(%q) = %v, want %v", test.segment, values, test.values)
+		}
+	}
+}
+
+func TestDecodeVLQInvalid(t *testing.T) {
+	for _, segment := range []string{"A!", "g", "AAg"} {
+		if _, err := decodeVLQ(segment); err == nil {
+			t.Errorf("decodeVLQ(%q) did not fail", segment)
+		}
+	}
+}
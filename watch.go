@@ -0,0 +1,145 @@
+package caddy_esbuild_plugin
+
+import (
+	"fmt"
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// watchGlobs pushes a reload to the live reload clients, without rebuilding,
+// whenever a file matching one of the watch globs changes.
+func (m *Esbuild) watchGlobs() {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		m.logger.Error("Failed to watch", zap.Error(err))
+		return
+	}
+
+	for _, glob := range m.Watch {
+		addWatchDirs(watcher, m.logger, globBase(glob))
+	}
+
+	go func() {
+		defer watcher.Close()
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if event.Op == fsnotify.Chmod {
+					continue
+				}
+				if event.Op&fsnotify.Create != 0 {
+					if stat, err := os.Stat(event.Name); err == nil && stat.IsDir() {
+						addWatchDirs(watcher, m.logger, event.Name)
+					}
+				}
+
+				name := filepath.ToSlash(filepath.Clean(event.Name))
+				for _, pattern := range m.watchPatterns {
+					if pattern.MatchString(name) {
+						m.logger.Debug("File changed, reloading", zap.String("filename", event.Name))
+						m.publishDebounced(buildEvent{Type: "reload", Changed: []string{name}})
+						break
+					}
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				m.logger.Error("Failed to watch!", zap.Error(err))
+			case <-m.globalQuit:
+				return
+			}
+		}
+	}()
+}
+
+// addWatchDirs watches dir and every directory below it.
+func addWatchDirs(watcher *fsnotify.Watcher, logger *zap.Logger, dir string) {
+	_ = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() {
+			return nil
+		}
+		if name := info.Name(); path != dir && (name == "node_modules" || name == ".git") {
+			return filepath.SkipDir
+		}
+		if err := watcher.Add(path); err != nil {
+			logger.Error("Failed to watch directory", zap.Error(err), zap.String("directory", path))
+		}
+		return nil
+	})
+}
+
+// globBase returns the directory part of a glob before the first wildcard.
+func globBase(glob string) string {
+	index := strings.IndexAny(glob, "*?[{")
+	if index < 0 {
+		return filepath.Dir(glob)
+	}
+	return filepath.Dir(glob[:index] + "x")
+}
+
+// compileGlobs turns the watch globs into patterns, failing on the first invalid glob.
+func compileGlobs(globs []string) ([]*regexp.Regexp, error) {
+	var patterns []*regexp.Regexp
+	for _, glob := range globs {
+		pattern, err := globToRegexp(glob)
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+// globToRegexp supports *, ?, ** for any number of directories and {a,b} alternatives.
+// A comma outside of braces is just a comma.
+func globToRegexp(glob string) (*regexp.Regexp, error) {
+	original := glob
+	glob = filepath.ToSlash(filepath.Clean(glob))
+
+	var pattern strings.Builder
+	pattern.WriteString("^")
+	braces := 0
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			pattern.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			pattern.WriteString(".*")
+			i++
+		case c == '*':
+			pattern.WriteString("[^/]*")
+		case c == '?':
+			pattern.WriteString("[^/]")
+		case c == '{':
+			braces++
+			pattern.WriteString("(?:")
+		case c == '}' && braces > 0:
+			braces--
+			pattern.WriteString(")")
+		case c == ',' && braces > 0:
+			pattern.WriteString("|")
+		default:
+			pattern.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	if braces > 0 {
+		return nil, fmt.Errorf("invalid watch glob %q: unclosed {", original)
+	}
+	pattern.WriteString("$")
+
+	compiled, err := regexp.Compile(pattern.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid watch glob %q: %v", original, err)
+	}
+	return compiled, nil
+}
@@ -0,0 +1,44 @@
+package caddy_esbuild_plugin
+
+import "testing"
+
+func TestGlobToRegexp(t *testing.T) {
+	tests := []struct {
+		glob    string
+		matches []string
+		misses  []string
+	}{
+		{"./src/**/*.html", []string{"src/index.html", "src/a/b/index.html"}, []string{"src/index.js", "web/index.html"}},
+		{"src/**", []string{"src/index.html", "src/a/b.js"}, []string{"web/index.html"}},
+		{"*.{html,php}", []string{"index.html", "index.php"}, []string{"index.js", "src/index.html"}},
+		{"views/{a,b}/*.php", []string{"views/a/x.php", "views/b/x.php"}, []string{"views/c/x.php", "views/a,b/x.php"}},
+		{"a,b.txt", []string{"a,b.txt"}, []string{"a", "b.txt"}},
+		{"?.js", []string{"a.js"}, []string{"ab.js", "/.js"}},
+		{"(a)+.js", []string{"(a)+.js"}, []string{"a.js", "aa.js"}},
+	}
+	for _, test := range tests {
+		pattern, err := globToRegexp(test.glob)
+		if err != nil {
+			t.Errorf("globToRegexp(%q) failed: %v", test.glob, err)
+			continue
+		}
+		for _, file := range test.matches {
+			if !pattern.MatchString(file) {
+				t.Errorf("glob %q does not match %q", test.glob, file)
+			}
+		}
+		for _, file := range test.misses {
+			if pattern.MatchString(file) {
+				t.Errorf("glob %q matches %q", test.glob, file)
+			}
+		}
+	}
+}
+
+func TestGlobToRegexpInvalid(t *testing.T) {
+	for _, glob := range []string{"{a,b", "src/{a/*.js", "{{a}"} {
+		if _, err := globToRegexp(glob); err == nil {
+			t.Errorf("globToRegexp(%q) did not fail", glob)
+		}
+	}
+}
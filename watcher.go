@@ -0,0 +1,123 @@
+package caddy_esbuild_plugin
+
+import (
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/zap"
+	"path/filepath"
+	"sync"
+)
+
+// fileWatcher is the single watcher the plugins register the files they read with.
+// It watches the parent directories, so atomic saves replacing a file are noticed too.
+// Without notify, there is no fsnotify watcher: when polling, pollFiles reports the changes instead.
+type fileWatcher struct {
+	lock    sync.Mutex
+	logger  *zap.Logger
+	watcher *fsnotify.Watcher
+	files   map[string]func(string)
+	dirs    map[string]bool
+}
+
+func newFileWatcher(logger *zap.Logger, notify bool) *fileWatcher {
+	w := &fileWatcher{
+		logger: logger,
+		files:  make(map[string]func(string)),
+		dirs:   make(map[string]bool),
+	}
+	if !notify {
+		return w
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		logger.Error("Failed to watch", zap.Error(err))
+		return w
+	}
+	w.watcher = watcher
+	go w.run()
+	return w
+}
+
+// add calls onChange with the file name whenever one of the files is written, created, renamed or removed.
+// Adding a file again only replaces the callback.
+func (w *fileWatcher) add(files []string, onChange func(string)) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	for _, file := range files {
+		file, err := filepath.Abs(file)
+		if err != nil {
+			continue
+		}
+		w.files[file] = onChange
+
+		dir := filepath.Dir(file)
+		if w.watcher == nil || w.dirs[dir] {
+			continue
+		}
+		if err := w.watcher.Add(dir); err != nil {
+			w.logger.Error("Failed to watch directory", zap.Error(err), zap.String("directory", dir))
+			continue
+		}
+		w.dirs[dir] = true
+	}
+}
+
+func (w *fileWatcher) list() []string {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	var files []string
+	for file := range w.files {
+		files = append(files, file)
+	}
+	return files
+}
+
+func (w *fileWatcher) changed(file string) {
+	w.lock.Lock()
+	onChange := w.files[file]
+	w.lock.Unlock()
+	if onChange != nil {
+		onChange(file)
+	}
+}
+
+func (w *fileWatcher) run() {
+	for {
+		select {
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Op == fsnotify.Chmod {
+				continue
+			}
+			name, err := filepath.Abs(event.Name)
+			if err != nil {
+				continue
+			}
+			w.changed(name)
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			w.logger.Error("Failed to watch!", zap.Error(err))
+		}
+	}
+}
+
+func (w *fileWatcher) close() {
+	if w.watcher != nil {
+		_ = w.watcher.Close()
+	}
+}
+
+// watchFiles rebuilds whenever one of the files the build or a plugin read changes.
+func (m *Esbuild) watchFiles(files []string) {
+	if m.watchMode() == "off" {
+		return
+	}
+	m.watcher.add(files, func(file string) {
+		m.logger.Debug("File changed, rebuilding", zap.String("filename", file))
+		m.scheduleRebuild()
+	})
+}